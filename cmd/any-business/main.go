@@ -1,7 +1,9 @@
 // AnyBusiness WebApplication with no specific purpose but all
 package main
 
-import "github.com/Koubae/GoAnyBusiness/internal/app"
+import (
+	"github.com/Koubae/GoAnyBusiness/internal/app"
+)
 
 func main() {
 	app.Run()
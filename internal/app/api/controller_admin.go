@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController serves the /admin endpoints of the app serving config, which reload reloads
+type AdminController struct {
+	config *core.Config
+	reload func() (*core.ReloadResult, error)
+}
+
+func (controller *AdminController) Reload(c *gin.Context) {
+	result, err := controller.reload()
+	if err != nil {
+		core.GinLogger(c).Errorf("Config reload failed, error: %s", err.Error())
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	result.Log(core.GinLogger(c))
+	c.JSON(http.StatusOK, result)
+}
+
+func (controller *AdminController) Config(c *gin.Context) {
+	entries := controller.config.Entries()
+	if c.Query("format") == "yaml" {
+		c.YAML(http.StatusOK, entries)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// LogLevels returns the level of every logger, or of the one named in the path
+func (controller *AdminController) LogLevels(c *gin.Context) {
+	name := c.Param("logger")
+	if name == "" {
+		c.JSON(http.StatusOK, core.GetLogLevels())
+		return
+	}
+
+	level, err := core.GetLogLevel(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, level)
+}
+
+// SetLogLevel changes the level of every logger, or of the one named in the path. With revert_after,
+// e.g. {"level": "debug", "revert_after": "15m"}, the level reverts to the configured one after that long.
+func (controller *AdminController) SetLogLevel(c *gin.Context) {
+	var request struct {
+		Level       string `json:"level" binding:"required"`
+		RevertAfter string `json:"revert_after"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var revertAfter time.Duration
+	if request.RevertAfter != "" {
+		var err error
+		if revertAfter, err = time.ParseDuration(request.RevertAfter); err != nil || revertAfter <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid revert_after '%s', expected a positive duration like 15m", request.RevertAfter)})
+			return
+		}
+	}
+
+	names := core.LoggerNames()
+	if name := c.Param("logger"); name != "" {
+		names = []string{name}
+	}
+	for _, name := range names {
+		if err := core.SetTemporaryLogLevel(name, request.Level, revertAfter); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, core.ErrUnknownLogger) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	until := "until changed"
+	if revertAfter > 0 {
+		until = "for " + revertAfter.String()
+	}
+	core.GinLogger(c).Warnf("Log level of %s set to %s %s", strings.Join(names, ", "), request.Level, until)
+	controller.LogLevels(c)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"expvar"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DebugController serves the runtime internals, only mounted on the admin router
+type DebugController struct{}
+
+// Vars returns the expvar metrics as JSON, the memory stats and command line along with any published var
+func (controller *DebugController) Vars(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// Pprof serves the pprof index and profiles, e.g. go tool pprof http://localhost:9090/debug/pprof/heap
+func (controller *DebugController) Pprof(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request) // Serves the named profiles too, e.g. /debug/pprof/heap
+	}
+}
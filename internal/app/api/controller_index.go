@@ -23,12 +23,31 @@ func (controller *IndexController) Ping(c *gin.Context) {
 	c.Data(http.StatusOK, "text/html; charset=utf-8", response)
 }
 
+// Alive tells the process is up, it must not depend on anything else so a broken dependency doesn't get
+// the process restarted
 func (controller *IndexController) Alive(c *gin.Context) {
 	response := []byte("OK")
 	c.Data(http.StatusOK, "text/html; charset=utf-8", response)
 }
 
+// Ready runs the registered health checks, see core.HealthChecker, and answers 503 when a critical one is down
 func (controller *IndexController) Ready(c *gin.Context) {
-	response := []byte("OK")
-	c.Data(http.StatusOK, "text/html; charset=utf-8", response)
+	report := core.GetHealthChecker().Check(c.Request.Context())
+	status := http.StatusOK
+	if report.Status == core.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Version returns the build metadata of the binary along with APP_VERSION, which defaults to the build
+// version, so a configured version that drifted from the binary shows
+func (controller *IndexController) Version(c *gin.Context) {
+	c.JSON(
+		http.StatusOK, struct {
+			AppName    string `json:"app_name"`
+			AppVersion string `json:"app_version"`
+			core.BuildInfo
+		}{controller.config.AppName, controller.config.AppVersion, core.GetBuildInfo()},
+	)
 }
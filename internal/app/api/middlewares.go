@@ -0,0 +1,205 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// MaintenanceMode rejects requests with 503 while the config has maintenance mode on,
+// the health probes and admin endpoints stay reachable
+func MaintenanceMode(config *core.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.MaintenanceMode || isMaintenanceExempt(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "120")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service under maintenance"})
+	}
+}
+
+func isMaintenanceExempt(path string) bool {
+	switch path {
+	case "/alive", "/ready", "/ping":
+		return true
+	default:
+		return strings.HasPrefix(path, "/admin/")
+	}
+}
+
+// RateLimit limits the requests per second of each client IP, disabled when config.RateLimitRPS is 0.
+// The buckets of the clients are kept in limiter, so they survive the router being rebuilt on config
+// reloads, which only update the rate and burst.
+func RateLimit(config *core.Config, limiter *RateLimiter) gin.HandlerFunc {
+	if config.RateLimitRPS <= 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	limiter.setLimit(rate.Limit(config.RateLimitRPS), config.RateLimitBurst)
+	return func(c *gin.Context) {
+		if !limiter.allow(c.ClientIP()) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminAuth requires the admin bearer token, rejecting every request when no token is configured
+func AdminAuth(config *core.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.AdminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API disabled, APP_ADMIN_TOKEN is not set"})
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequestID accepts the X-Request-ID of the request or generates one, then stores it in the gin context and
+// the request context, where the access log and ContextLogger pick it up, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(core.RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = core.NewRequestID()
+		}
+		c.Set(core.RequestIDKey, requestID)
+		c.Request = c.Request.WithContext(core.WithRequestID(c.Request.Context(), requestID))
+		c.Header(core.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// ContextLogger puts a logger carrying the request ID, method and route in the request context, see
+// core.LoggerFrom. Run it after RequestID.
+func ContextLogger(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestLogger := logger.With(core.RequestIDFields(c.Request.Context())...).Sugar().With(
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+		)
+		c.Request = c.Request.WithContext(core.WithLogger(c.Request.Context(), requestLogger))
+		c.Next()
+	}
+}
+
+// Recovery answers 500 on panics, logged with their stack by the logger of the request. A panic writing to
+// a connection closed by the client is logged without the stack and left unanswered.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			logger := core.GinLogger(c)
+			if cause, ok := err.(error); ok && (errors.Is(cause, syscall.EPIPE) || errors.Is(cause, syscall.ECONNRESET)) {
+				logger.Errorw("Connection closed by the client", "error", cause)
+				_ = c.Error(cause)
+				c.Abort()
+				return
+			}
+			logger.Errorw("Recovered from panic", "error", err, "stack", string(debug.Stack()))
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
+
+// isValidRequestID accepts IDs set by proxies or clients, like UUIDs, as long as they are safe to log and echo
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for _, r := range requestID {
+		isAlphanumeric := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlphanumeric && !strings.ContainsRune("-_.:/+=", r) {
+			return false
+		}
+	}
+	return true
+}
+
+const clientRateLimiterTTL = 10 * time.Minute
+
+// RateLimiter holds the token bucket of each client IP for RateLimit
+type RateLimiter struct {
+	lock      sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a RateLimiter for RateLimit, which sets its rate and burst
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		clients:   make(map[string]*clientLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+// setLimit changes the rate and burst of every client, keeping the tokens they have left
+func (l *RateLimiter) setLimit(limit rate.Limit, burst int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if limit == l.limit && burst == l.burst {
+		return
+	}
+	l.limit, l.burst = limit, burst
+	now := time.Now()
+	for _, client := range l.clients {
+		client.limiter.SetLimitAt(now, limit)
+		client.limiter.SetBurstAt(now, burst)
+	}
+}
+
+func (l *RateLimiter) allow(clientIP string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > clientRateLimiterTTL {
+		for ip, client := range l.clients {
+			if now.Sub(client.lastSeen) > clientRateLimiterTTL {
+				delete(l.clients, ip)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[clientIP]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[clientIP] = client
+	}
+	client.lastSeen = now
+	return client.limiter.AllowN(now, 1)
+}
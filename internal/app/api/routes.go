@@ -9,11 +9,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// ConfigureRouter configures the router
-func ConfigureRouter(router *gin.Engine, config *core.Config) error {
+// ConfigureRouter configures the public router, along with the health probes and admin endpoints
+// unless APP_ADMIN_PORT moves them to the admin router, see ConfigureAdminRouter. The rate limits of the
+// clients are kept in limiter across routers, reload reloads config for POST /admin/reload.
+func ConfigureRouter(
+	router *gin.Engine,
+	config *core.Config,
+	limiter *RateLimiter,
+	reload func() (*core.ReloadResult, error),
+) error {
 	allowOrigin := []string{"*"}
 	allowALlOrigins := false
-	if config.Env != core.Production {
+	if len(config.CORSAllowOrigins) > 0 {
+		allowOrigin = config.CORSAllowOrigins
+	} else if config.Env != core.Production {
 		allowOrigin = nil
 		allowALlOrigins = true
 	}
@@ -22,14 +31,16 @@ func ConfigureRouter(router *gin.Engine, config *core.Config) error {
 		cors.New(
 			cors.Config{
 				AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-				AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-				ExposeHeaders:    []string{"Content-Length"},
+				AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", core.RequestIDHeader},
+				ExposeHeaders:    []string{"Content-Length", core.RequestIDHeader},
 				MaxAge:           12 * time.Hour,
 				AllowCredentials: false,
 				AllowOrigins:     allowOrigin,
 				AllowAllOrigins:  allowALlOrigins,
 			},
 		),
+		MaintenanceMode(config),
+		RateLimit(config, limiter),
 	)
 	err := router.SetTrustedProxies(config.TrustedProxies)
 	if err != nil {
@@ -43,9 +54,59 @@ func ConfigureRouter(router *gin.Engine, config *core.Config) error {
 	{
 		index.GET("/", indexController.Index)
 		index.GET("/ping", indexController.Ping)
-		index.GET("/alive", indexController.Alive)
-		index.GET("/ready", indexController.Ready)
+		index.GET("/version", indexController.Version)
 	}
+	if config.AdminPort == 0 {
+		configureHealthRoutes(index, indexController)
+		configureAdminRoutes(router, config, reload)
+	}
+
+	return nil
+}
+
+// ConfigureAdminRouter configures the router of the admin server, which also serves the expvar
+// metrics and pprof profiles that are never exposed on the public router
+func ConfigureAdminRouter(router *gin.Engine, config *core.Config, reload func() (*core.ReloadResult, error)) error {
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return fmt.Errorf("Error setting trusted proxies, error: %s", err.Error())
+	}
+
+	index := router.Group("/")
+	indexController := &IndexController{
+		config: config,
+	}
+	{
+		index.GET("/ping", indexController.Ping)
+	}
+	configureHealthRoutes(index, indexController)
+
+	debug := router.Group("/debug")
+	debugController := &DebugController{}
+	{
+		debug.GET("/vars", debugController.Vars)
+		debug.GET("/pprof/*profile", debugController.Pprof)
+		debug.POST("/pprof/symbol", debugController.Pprof)
+	}
+	router.GET("/metrics", debugController.Vars)
 
+	configureAdminRoutes(router, config, reload)
 	return nil
 }
+
+func configureHealthRoutes(index *gin.RouterGroup, indexController *IndexController) {
+	index.GET("/alive", indexController.Alive)
+	index.GET("/ready", indexController.Ready)
+}
+
+func configureAdminRoutes(router *gin.Engine, config *core.Config, reload func() (*core.ReloadResult, error)) {
+	admin := router.Group("/admin", AdminAuth(config))
+	adminController := &AdminController{config: config, reload: reload}
+	{
+		admin.GET("/config", adminController.Config)
+		admin.POST("/reload", adminController.Reload)
+		admin.GET("/log-level", adminController.LogLevels)
+		admin.GET("/log-level/:logger", adminController.LogLevels)
+		admin.PUT("/log-level", adminController.SetLogLevel)
+		admin.PUT("/log-level/:logger", adminController.SetLogLevel)
+	}
+}
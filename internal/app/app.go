@@ -0,0 +1,519 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/api"
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+// App is the HTTP server of the application along with its lifecycle hooks. It can be started
+// in-process by tests or embedded in another binary, Run wraps it with the command line, the .env
+// files and signal handling.
+type App struct {
+	config           *core.Config
+	name             string
+	logger           *zap.Logger
+	loggerMiddleware gin.HandlerFunc
+	hooks            []Hook
+	router           *reloadableHandler
+	rateLimiter      *api.RateLimiter
+	lifecycle        *Lifecycle
+	server           *http.Server
+	// redirectServer redirects plain HTTP to HTTPS, nil unless APP_TLS_REDIRECT_PORT is set
+	redirectServer *http.Server
+	// http3Server serves HTTP/3 on the UDP port of the server, nil unless APP_TLS_HTTP3 is set
+	http3Server *http3.Server
+	// adminServer serves the health probes and admin endpoints, nil unless APP_ADMIN_PORT is set
+	adminServer *http.Server
+	adminRouter *reloadableHandler
+	// reloaded is the config once reloaded, see Reload
+	reloaded         atomic.Pointer[core.Config]
+	reloadLock       sync.Mutex
+	removeReloadHook func()
+
+	lock             sync.Mutex
+	listener         net.Listener
+	adminListener    net.Listener
+	redirectListener net.Listener
+	packetConn       net.PacketConn
+	done             chan error
+	serving          sync.WaitGroup
+	// handedOver is set once Upgrade handed the listeners over to a new process, see handOver
+	handedOver   atomic.Bool
+	newConns     sync.Map
+	newConnCount atomic.Int64
+}
+
+// Option customizes an App created by New
+type Option func(*App)
+
+// WithLogger sets the logger and the request logging middleware, created from the config by
+// core.CreateLogger by default
+func WithLogger(logger *zap.Logger, middleware gin.HandlerFunc) Option {
+	return func(app *App) {
+		app.logger = logger
+		app.loggerMiddleware = middleware
+	}
+}
+
+// WithHooks appends lifecycle hooks, started after the ones registered with RegisterHook
+func WithHooks(hooks ...Hook) Option {
+	return func(app *App) {
+		app.hooks = append(app.hooks, hooks...)
+	}
+}
+
+// WithListener serves on listener instead of listening on the configured address
+func WithListener(listener net.Listener) Option {
+	return func(app *App) {
+		app.listener = listener
+	}
+}
+
+// WithAdminListener serves the admin server on listener instead of listening on APP_ADMIN_PORT,
+// which must still be set for the admin server to be created
+func WithAdminListener(listener net.Listener) Option {
+	return func(app *App) {
+		app.adminListener = listener
+	}
+}
+
+// New creates the app of config, nothing is started until Start
+func New(config *core.Config, opts ...Option) (*App, error) {
+	app := &App{
+		config:      config,
+		name:        fmt.Sprintf("Service %s-V%s", config.AppName, config.AppVersion),
+		rateLimiter: api.NewRateLimiter(),
+		done:        make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	if app.logger == nil {
+		logger, middleware, err := core.CreateLogger(config)
+		if err != nil {
+			return nil, fmt.Errorf("error creating logger: %w", err)
+		}
+		app.logger, app.loggerMiddleware = logger, *middleware
+	}
+	setGinMode(config.Env)
+	app.reloaded.Store(config)
+
+	router, err := newRouter(config, app.logger, app.loggerMiddleware, app.rateLimiter, app.Reload)
+	if err != nil {
+		return nil, err
+	}
+	app.router = &reloadableHandler{}
+	app.router.router.Store(router)
+
+	app.lifecycle = NewLifecycle(app.logger.Sugar())
+	hooksLock.Lock()
+	for _, hook := range hooks {
+		app.lifecycle.Append(hook)
+	}
+	hooksLock.Unlock()
+	for _, hook := range app.hooks {
+		app.lifecycle.Append(hook)
+	}
+
+	app.server = &http.Server{
+		Handler:           http.MaxBytesHandler(app.router, int64(config.Server.MaxBodySize)),
+		ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+		ReadTimeout:       config.Server.ReadTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+	}
+	if config.TLS.Enabled() {
+		reloader, err := newTLSReloader(config.TLS, app.logger.Sugar())
+		if err != nil {
+			return nil, err
+		}
+		app.server.TLSConfig = reloader.serverConfig()
+	}
+	if config.TLS.HTTP3 {
+		app.http3Server = &http3.Server{
+			Handler:     app.server.Handler,
+			TLSConfig:   app.server.TLSConfig,
+			IdleTimeout: config.Server.IdleTimeout,
+		}
+		app.server.Handler = altSvcHandler(app.http3Server, app.server.Handler)
+	}
+	if config.AdminPort != 0 {
+		adminRouter, err := newAdminRouter(config, app.logger, app.loggerMiddleware, app.Reload)
+		if err != nil {
+			return nil, err
+		}
+		app.adminRouter = &reloadableHandler{}
+		app.adminRouter.router.Store(adminRouter)
+		app.adminServer = &http.Server{
+			Addr:              config.GetAdminAddr(),
+			Handler:           http.MaxBytesHandler(app.adminRouter, int64(config.Server.MaxBodySize)),
+			ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+			ReadTimeout:       config.Server.ReadTimeout,
+			IdleTimeout:       config.Server.IdleTimeout,
+			// No WriteTimeout, CPU profiles and traces stream for as long as their ?seconds= asks
+		}
+	}
+	if config.TLS.RedirectPort != 0 {
+		app.redirectServer = &http.Server{
+			Addr: fmt.Sprintf(":%d", config.TLS.RedirectPort),
+			// Handler is set by Start, redirecting to the port actually listened on since APP_PORT may be 0
+			ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+			IdleTimeout:       config.Server.IdleTimeout,
+		}
+	}
+	for _, server := range []*http.Server{app.server, app.adminServer, app.redirectServer} {
+		if server != nil {
+			server.ConnState = app.trackNewConn
+		}
+	}
+	// Reloads of config through core.ReloadConfig apply too, as with Reload
+	app.removeReloadHook = core.OnConfigReloadOf(config, app.applyConfigReload)
+	return app, nil
+}
+
+// Handler returns the HTTP handler of the app, usable without starting it, e.g. with httptest
+func (app *App) Handler() http.Handler {
+	return app.server.Handler
+}
+
+// AdminHandler returns the HTTP handler of the admin server, nil unless APP_ADMIN_PORT is set
+func (app *App) AdminHandler() http.Handler {
+	if app.adminServer == nil {
+		return nil
+	}
+	return app.adminServer.Handler
+}
+
+// Addr returns the address the app listens on once started, so the actual port when APP_PORT is 0,
+// or the configured address before. It is the socket path with APP_LISTEN.
+func (app *App) Addr() string {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	if app.listener != nil {
+		return app.listener.Addr().String()
+	}
+	_, address := app.config.GetListenAddr()
+	return address
+}
+
+// AdminAddr returns the address the admin server listens on once started, or the configured
+// address before, empty unless APP_ADMIN_PORT is set
+func (app *App) AdminAddr() string {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	if app.adminServer == nil {
+		return ""
+	}
+	if app.adminListener != nil {
+		return app.adminListener.Addr().String()
+	}
+	return app.adminServer.Addr
+}
+
+// Start runs the lifecycle start hooks then serves in the background, it returns once every
+// server listens. Serving errors of the main server are sent on Done.
+func (app *App) Start(ctx context.Context) error {
+	logger := app.logger.Sugar()
+	core.GetHealthChecker().SetDraining(false)
+	if err := app.lifecycle.Start(ctx); err != nil {
+		return fmt.Errorf("%s - startup failure: %w", app.name, err)
+	}
+
+	app.lock.Lock()
+	err := app.listen(ctx)
+	listener, adminListener, redirectListener, packetConn := app.listener, app.adminListener, app.redirectListener, app.packetConn
+	app.lock.Unlock()
+	if err != nil {
+		return errors.Join(fmt.Errorf("%s - %w", app.name, err), app.lifecycle.Stop(context.Background()))
+	}
+
+	if app.adminServer != nil {
+		app.serving.Add(1)
+		go func() {
+			defer app.serving.Done()
+			if err := app.serveErr(app.adminServer.Serve(adminListener)); err != nil {
+				logger.Errorf("%s - admin server failure, error: %v", app.name, err)
+			}
+		}()
+		logger.Infof("%s | Admin server started on %s (http)", app.name, adminListener.Addr())
+	}
+	if app.redirectServer != nil {
+		app.redirectServer.Handler = httpsRedirect(listenerPort(listener, app.config.Port))
+		app.serving.Add(1)
+		go func() {
+			defer app.serving.Done()
+			if err := app.serveErr(app.redirectServer.Serve(redirectListener)); err != nil {
+				logger.Errorf("%s - HTTPS redirect server failure, error: %v", app.name, err)
+			}
+		}()
+		logger.Infof("%s | Redirecting HTTP to HTTPS on %s", app.name, redirectListener.Addr())
+	}
+	if app.http3Server != nil {
+		go func() {
+			if err := app.http3Server.Serve(packetConn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("%s - HTTP/3 server failure, error: %v", app.name, err)
+			}
+		}()
+		logger.Infof("%s | Serving HTTP/3 on %s (udp)", app.name, packetConn.LocalAddr())
+	}
+
+	// Read before serving, ServeTLS configures HTTP/2 on TLSConfig
+	scheme := "http"
+	if app.server.TLSConfig != nil {
+		scheme = "https"
+	}
+	app.serving.Add(1)
+	go func() {
+		defer app.serving.Done()
+		var err error
+		if scheme == "https" {
+			err = app.server.ServeTLS(listener, "", "")
+		} else {
+			err = app.server.Serve(listener)
+		}
+		app.done <- app.serveErr(err)
+	}()
+	logger.Infof("%s | Server started on %s (%s)", app.name, listener.Addr(), scheme)
+	if err := notifyUpgradeReady(); err != nil {
+		logger.Warnf("%s - error notifying the parent process of the upgrade, error: %v", app.name, err)
+	}
+	return nil
+}
+
+// listen opens the listeners of every server that has none yet, first from the sockets inherited from
+// systemd or the parent of an upgrade, or none when one fails, so a port already in use fails Start as a
+// whole. Must be called with the lock held.
+func (app *App) listen(ctx context.Context) (err error) {
+	if err := app.useInheritedSockets(); err != nil {
+		return err
+	}
+
+	var opened []io.Closer
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, closer := range opened {
+			_ = closer.Close()
+		}
+		app.listener, app.adminListener, app.redirectListener, app.packetConn = nil, nil, nil, nil
+	}()
+	listenConfig := &net.ListenConfig{}
+
+	if app.listener == nil {
+		if network, address := app.config.GetListenAddr(); network == "unix" {
+			app.listener, err = listenUnix(ctx, address, app.config)
+		} else {
+			app.listener, err = listenConfig.Listen(ctx, network, address)
+		}
+		if err != nil {
+			return fmt.Errorf("error listening: %w", err)
+		}
+	}
+	opened = append(opened, app.listener)
+
+	if app.adminServer != nil {
+		if app.adminListener == nil {
+			if app.adminListener, err = listenConfig.Listen(ctx, "tcp", app.adminServer.Addr); err != nil {
+				return fmt.Errorf("error listening for the admin server: %w", err)
+			}
+		}
+		opened = append(opened, app.adminListener)
+	}
+	if app.redirectServer != nil {
+		if app.redirectListener == nil {
+			if app.redirectListener, err = listenConfig.Listen(ctx, "tcp", app.redirectServer.Addr); err != nil {
+				return fmt.Errorf("error listening for HTTPS redirects: %w", err)
+			}
+		}
+		opened = append(opened, app.redirectListener)
+	}
+	if app.http3Server != nil && app.packetConn == nil {
+		// Same port as the TCP listener, which may have been picked when APP_PORT is 0
+		if app.packetConn, err = listenConfig.ListenPacket(ctx, "udp", app.listener.Addr().String()); err != nil {
+			return fmt.Errorf("error listening for HTTP/3: %w", err)
+		}
+	}
+	return nil
+}
+
+// useInheritedSockets serves on the sockets inherited from systemd or the parent of an upgrade, by name,
+// see inheritedSockets
+func (app *App) useInheritedSockets() error {
+	sockets, err := inheritedSockets()
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		switch {
+		case socket.name == adminFdName && app.adminServer != nil && app.adminListener == nil:
+			app.adminListener = socket.listener
+		case socket.name == redirectFdName && app.redirectServer != nil && app.redirectListener == nil:
+			app.redirectListener = socket.listener
+		case socket.name == http3FdName && app.http3Server != nil && app.packetConn == nil:
+			app.packetConn = socket.packetConn
+		case !slices.Contains([]string{adminFdName, redirectFdName, http3FdName}, socket.name) && app.listener == nil:
+			app.listener = socket.listener
+		default:
+			app.logger.Sugar().Warnf("%s - ignoring the inherited socket %q", app.name, socket.name)
+			_ = socket.Close()
+		}
+	}
+	return nil
+}
+
+// Done receives the error of the server once it stops serving, nil when stopped by Stop or once
+// Upgrade handed its listener over
+func (app *App) Done() <-chan error {
+	return app.done
+}
+
+// Drain makes /ready fail so load balancers stop routing new traffic, while the server keeps
+// serving for APP_SERVER_DRAIN_PERIOD or until ctx is done. Call it before Stop.
+func (app *App) Drain(ctx context.Context) {
+	core.GetHealthChecker().SetDraining(true)
+	app.server.SetKeepAlivesEnabled(false) // Have clients reconnect, to another instance, after each request
+	period := app.config.Server.DrainPeriod
+	if period <= 0 {
+		return
+	}
+
+	app.logger.Sugar().Infof("%s - draining for %s, /ready now fails", app.name, period)
+	timer := time.NewTimer(period)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Stop gracefully shuts the servers down, the admin server last, then runs the lifecycle stop hooks in reverse order.
+// In-flight requests are given until the deadline of ctx, or APP_SERVER_SHUTDOWN_TIMEOUT when
+// it has none, before the server is closed. Cancelling ctx forces the shutdown, while the stop hooks
+// still run, each bounded by its own Timeout.
+func (app *App) Stop(ctx context.Context) error {
+	logger := app.logger.Sugar()
+	shutdownCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(ctx, app.config.Server.ShutdownTimeout)
+		defer cancel()
+	}
+
+	var errs []error
+	if app.redirectServer != nil {
+		if err := app.redirectServer.Shutdown(shutdownCtx); err != nil {
+			_ = app.redirectServer.Close()
+		}
+	}
+	if app.http3Server != nil {
+		if err := app.http3Server.Shutdown(shutdownCtx); err != nil {
+			_ = app.http3Server.Close()
+			errs = append(errs, err)
+		}
+	}
+	if err := app.server.Shutdown(shutdownCtx); err != nil {
+		_ = app.server.Close() // If shutdown times out, force close:
+		logger.Infof("%s - Server forced to shutdown: %v", app.name, err)
+		errs = append(errs, err)
+	}
+	// Last, so the probes keep answering while the other servers shut down
+	if app.adminServer != nil {
+		if err := app.adminServer.Shutdown(shutdownCtx); err != nil {
+			_ = app.adminServer.Close()
+			errs = append(errs, err)
+		}
+	}
+
+	app.removeReloadHook()
+	logger.Infof("%s - Server Shutdown, cleaning up resources", app.name)
+	// Not cancelled along with ctx, so resources are cleaned up even after a forced shutdown
+	if err := app.lifecycle.Stop(context.WithoutCancel(ctx)); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// serveErr returns the error of a server that stopped serving, nil when stopped by Stop or handOver
+func (app *App) serveErr(err error) error {
+	if errors.Is(err, http.ErrServerClosed) || (app.handedOver.Load() && errors.Is(err, net.ErrClosed)) {
+		return nil
+	}
+	return err
+}
+
+// Reload re-reads the config of the app and applies the changes that are safe at runtime, see core.Reload.
+// SIGHUP and POST /admin/reload call it.
+func (app *App) Reload() (*core.ReloadResult, error) {
+	app.reloadLock.Lock()
+	defer app.reloadLock.Unlock()
+
+	_, result, err := core.Reload(app.reloaded.Load())
+	return result, err
+}
+
+// applyConfigReload applies the runtime-safe config values: the log levels directly, while trusted
+// proxies, CORS, rate limits and maintenance mode are picked up by rebuilding the routers
+func (app *App) applyConfigReload(config *core.Config) {
+	app.reloaded.Store(config)
+	logger := app.logger.Sugar()
+	if err := core.ApplyLogLevels(config); err != nil {
+		logger.Errorf("Error applying reloaded log levels, error: %s", err.Error())
+	}
+
+	router, err := newRouter(config, app.logger, app.loggerMiddleware, app.rateLimiter, app.Reload)
+	if err != nil {
+		logger.Errorf("Error rebuilding router with reloaded config, keeping the current one, error: %s", err.Error())
+		return
+	}
+	var adminRouter *gin.Engine
+	if app.adminRouter != nil {
+		if adminRouter, err = newAdminRouter(config, app.logger, app.loggerMiddleware, app.Reload); err != nil {
+			logger.Errorf("Error rebuilding admin router with reloaded config, keeping the current one, error: %s", err.Error())
+			return
+		}
+	}
+	app.router.router.Store(router)
+	if adminRouter != nil {
+		app.adminRouter.router.Store(adminRouter)
+	}
+}
+
+// syncLogger flushes the logger, ignoring the benign errors of non-file sinks
+func (app *App) syncLogger() {
+	if err := app.logger.Sync(); err != nil {
+		// Sync can return "invalid argument" on non-file sinks like /dev/stderr (benign).
+		if err.Error() == "sync /dev/stderr: invalid argument" || err.Error() == "sync /dev/stdout: invalid argument" {
+			return
+		}
+		log.Printf("Error syncing logger: %s", err.Error())
+	}
+}
+
+func setGinMode(env core.Environment) {
+	switch env {
+	case core.Testing:
+		gin.SetMode(gin.TestMode)
+	case core.Development, core.Staging:
+		gin.SetMode(gin.DebugMode)
+	default:
+		gin.SetMode(gin.ReleaseMode)
+	}
+}
@@ -0,0 +1,562 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/api"
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestApp creates an App of the config resolved with args, logging nothing
+func newTestApp(t *testing.T, args []string, opts ...Option) *App {
+	config, err := core.LoadConfig(core.WithArgs(args))
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	opts = append([]Option{WithLogger(zap.NewNop(), func(c *gin.Context) { c.Next() })}, opts...)
+	app, err := New(config, opts...)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	return app
+}
+
+// helperProcessEnvKey makes the test binary run the named helper process instead of the tests, so
+// sockets can be passed to it as file descriptors 3 and up, like systemd or an upgrade does
+const helperProcessEnvKey = "APP_TEST_HELPER_PROCESS"
+
+var helperProcesses = map[string]func() int{
+	"inherited-sockets": inheritedSocketsHelper,
+	"serve":             serveHelper,
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(helperProcessEnvKey); name != "" {
+		os.Exit(helperProcesses[name]())
+	}
+	os.Exit(m.Run())
+}
+
+// startHelperProcess starts the test binary as the named helper process with files as file descriptors 3 and up,
+// the returned stdout stays readable once it exits, for the processes it started
+func startHelperProcess(t *testing.T, name string, files []*os.File, env ...string) (*exec.Cmd, io.Reader) {
+	stdout, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	t.Cleanup(func() { _ = stdout.Close() })
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(upgradeEnviron(), append(env, helperProcessEnvKey+"="+name)...)
+	cmd.ExtraFiles = files
+	cmd.Stdout, cmd.Stderr = writer, os.Stderr
+	err = cmd.Start()
+	_ = writer.Close()
+	if err != nil {
+		t.Fatalf("start helper process: %v", err)
+	}
+	t.Cleanup(
+		func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		},
+	)
+	return cmd, stdout
+}
+
+func TestApp(t *testing.T) {
+	newApp := func(t *testing.T, opts ...Option) *App {
+		return newTestApp(t, []string{"--app-port=0"}, opts...)
+	}
+
+	t.Run(
+		"handler", func(t *testing.T) {
+			app := newApp(t)
+			recorder := httptest.NewRecorder()
+			app.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+			if recorder.Code != http.StatusOK || recorder.Body.String() != "pong" {
+				t.Errorf("GET /ping = %d %q, want 200 \"pong\"", recorder.Code, recorder.Body.String())
+			}
+		},
+	)
+
+	t.Run(
+		"request id", func(t *testing.T) {
+			app := newApp(t)
+			tests := []struct {
+				name      string
+				requestID string
+				echoed    bool
+			}{
+				{"generated", "", false},
+				{"accepted", "7c4d2a1e-0b5f-4e8a-9d3c-2f1e0a9b8c7d", true},
+				{"unsafe replaced", "evil\r\nSet-Cookie: x", false},
+			}
+			for _, tt := range tests {
+				request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+				if tt.requestID != "" {
+					request.Header.Set(core.RequestIDHeader, tt.requestID)
+				}
+				recorder := httptest.NewRecorder()
+				app.Handler().ServeHTTP(recorder, request)
+
+				got := recorder.Header().Get(core.RequestIDHeader)
+				if tt.echoed && got != tt.requestID {
+					t.Errorf("%s: %s = %q, want %q", tt.name, core.RequestIDHeader, got, tt.requestID)
+				}
+				if !tt.echoed && len(got) != 32 {
+					t.Errorf("%s: %s = %q, want a generated ID", tt.name, core.RequestIDHeader, got)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"version keeps the build version", func(t *testing.T) {
+			app := newTestApp(t, []string{"--app-port=0", "--app-version=9.9.9"})
+			recorder := httptest.NewRecorder()
+			app.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+			var got struct {
+				Version    string `json:"version"`
+				AppVersion string `json:"app_version"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("GET /version = %d %q, unexpected error: %v", recorder.Code, recorder.Body.String(), err)
+			}
+			if got.Version != core.GetBuildInfo().Version || got.AppVersion != "9.9.9" {
+				t.Errorf("GET /version = %+v, want version %q and app_version \"9.9.9\"", got, core.GetBuildInfo().Version)
+			}
+		},
+	)
+
+	t.Run(
+		"rate limit survives reload", func(t *testing.T) {
+			app := newTestApp(t, []string{"--app-port=0", "--app-rate-limit-rps=0.001", "--app-rate-limit-burst=1"})
+			get := func() int {
+				recorder := httptest.NewRecorder()
+				app.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+				return recorder.Code
+			}
+
+			if code := get(); code != http.StatusOK {
+				t.Fatalf("first GET /ping = %d, want %d", code, http.StatusOK)
+			}
+			app.applyConfigReload(app.config)
+			if code := get(); code != http.StatusTooManyRequests {
+				t.Errorf("GET /ping after reload = %d, want %d", code, http.StatusTooManyRequests)
+			}
+		},
+	)
+
+	t.Run(
+		"drain fails readiness", func(t *testing.T) {
+			app := newApp(t)
+			if err := app.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+			app.Drain(context.Background())
+
+			recorder := httptest.NewRecorder()
+			app.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Errorf("GET /ready while draining = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+			}
+			if err := app.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop() unexpected error: %v", err)
+			}
+		},
+	)
+
+	t.Run(
+		"start and stop on a free port", func(t *testing.T) {
+			var calls []string
+			app := newApp(
+				t, WithHooks(
+					Hook{
+						Name: "worker",
+						Start: func(context.Context) error {
+							calls = append(calls, "start")
+							return nil
+						},
+						Stop: func(context.Context) error {
+							calls = append(calls, "stop")
+							return nil
+						},
+					},
+				),
+			)
+			if err := app.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+
+			response, err := http.Get("http://" + app.Addr() + "/ping")
+			if err != nil {
+				t.Fatalf("GET /ping unexpected error: %v", err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			_ = response.Body.Close()
+			if response.StatusCode != http.StatusOK || string(body) != "pong" {
+				t.Errorf("GET /ping = %d %q, want 200 \"pong\"", response.StatusCode, body)
+			}
+
+			if err := app.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop() unexpected error: %v", err)
+			}
+			if err := <-app.Done(); err != nil {
+				t.Errorf("Done() = %v, want nil", err)
+			}
+			if len(calls) != 2 {
+				t.Errorf("hook calls = %v, want [start stop]", calls)
+			}
+		},
+	)
+
+	t.Run(
+		"forced stop still runs the stop hooks", func(t *testing.T) {
+			var stopErr error
+			stopped := false
+			app := newApp(
+				t, WithHooks(
+					Hook{
+						Name: "pool",
+						Stop: func(ctx context.Context) error {
+							stopped, stopErr = true, ctx.Err()
+							return nil
+						},
+					},
+				),
+			)
+			if err := app.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_ = app.Stop(ctx)
+			if !stopped || stopErr != nil {
+				t.Errorf("stop hook ran: %v with ctx error %v, want it run with a live ctx", stopped, stopErr)
+			}
+		},
+	)
+
+	t.Run(
+		"admin listener", func(t *testing.T) {
+			adminListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			// APP_ADMIN_PORT enables the admin server, which serves on adminListener instead
+			app := newTestApp(t, []string{"--app-port=0", "--app-admin-port=18001"}, WithAdminListener(adminListener))
+			if err := app.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+			defer func() {
+				if err := app.Stop(context.Background()); err != nil {
+					t.Errorf("Stop() unexpected error: %v", err)
+				}
+			}()
+
+			tests := []struct {
+				addr   string
+				path   string
+				status int
+			}{
+				{app.Addr(), "/ping", http.StatusOK},
+				{app.Addr(), "/ready", http.StatusNotFound},
+				{app.Addr(), "/debug/pprof/", http.StatusNotFound},
+				{app.Addr(), "/admin/config", http.StatusNotFound},
+				{app.AdminAddr(), "/alive", http.StatusOK},
+				{app.AdminAddr(), "/ready", http.StatusOK},
+				{app.AdminAddr(), "/metrics", http.StatusOK},
+				{app.AdminAddr(), "/debug/pprof/", http.StatusOK},
+				{app.AdminAddr(), "/debug/pprof/heap?debug=1", http.StatusOK},
+				{app.AdminAddr(), "/admin/config", http.StatusForbidden},
+			}
+			// A connection per request, the transport could otherwise dial one it never sends a request on,
+			// which Shutdown waits for
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			for _, tt := range tests {
+				response, err := client.Get("http://" + tt.addr + tt.path)
+				if err != nil {
+					t.Fatalf("GET %s%s unexpected error: %v", tt.addr, tt.path, err)
+				}
+				_ = response.Body.Close()
+				if response.StatusCode != tt.status {
+					t.Errorf("GET %s%s = %d, want %d", tt.addr, tt.path, response.StatusCode, tt.status)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"admin router reloads", func(t *testing.T) {
+			var clientIP string
+			app := newTestApp(
+				t, []string{"--app-port=0", "--app-admin-port=18001"},
+				WithLogger(
+					zap.NewNop(), func(c *gin.Context) {
+						clientIP = c.ClientIP()
+						c.Next()
+					},
+				),
+			)
+			get := func() string {
+				request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+				request.Header.Set("X-Forwarded-For", "203.0.113.7")
+				app.AdminHandler().ServeHTTP(httptest.NewRecorder(), request)
+				return clientIP
+			}
+
+			if got := get(); got != "192.0.2.1" {
+				t.Errorf("client IP before reload = %v, want the remote address 192.0.2.1", got)
+			}
+			config := *app.config
+			config.TrustedProxies = []string{"192.0.2.1"}
+			app.applyConfigReload(&config)
+			if got := get(); got != "203.0.113.7" {
+				t.Errorf("client IP after trusting the proxy = %v, want 203.0.113.7", got)
+			}
+		},
+	)
+
+	t.Run(
+		"request id in the access and recovery logs", func(t *testing.T) {
+			config, err := core.LoadConfig(core.WithArgs([]string{"--app-log-level=debug"}))
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			observed, logs := observer.New(zap.DebugLevel)
+			logger, middleware, err := core.CreateLogger(
+				config, zap.WrapCore(func(zapcore.Core) zapcore.Core { return observed }),
+			)
+			if err != nil {
+				t.Fatalf("CreateLogger() unexpected error: %v", err)
+			}
+			router, err := newRouter(config, logger, *middleware, api.NewRateLimiter(), nil)
+			if err != nil {
+				t.Fatalf("newRouter() unexpected error: %v", err)
+			}
+			router.GET("/panic", func(*gin.Context) { panic("boom") })
+
+			request := httptest.NewRequest(http.MethodGet, "/panic", nil)
+			request.Header.Set(core.RequestIDHeader, "abc-123")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusInternalServerError {
+				t.Errorf("GET /panic = %d, want %d", recorder.Code, http.StatusInternalServerError)
+			}
+
+			recovery := logs.FilterMessage("Recovered from panic").All()
+			access := logs.Filter(func(entry observer.LoggedEntry) bool { return entry.LoggerName == core.HTTPLoggerName }).All()
+			if len(recovery) != 1 || len(access) != 1 {
+				t.Fatalf("got %d recovery and %d access log entries, want 1 of each: %v", len(recovery), len(access), logs.All())
+			}
+			for _, entry := range []observer.LoggedEntry{recovery[0], access[0]} {
+				if got := entry.ContextMap()[core.RequestIDKey]; got != "abc-123" {
+					t.Errorf("%q log entry %s = %v, want abc-123", entry.Message, core.RequestIDKey, got)
+				}
+			}
+			if status := access[0].ContextMap()["status"]; status != int64(http.StatusInternalServerError) {
+				t.Errorf("access log status = %v, want %d", status, http.StatusInternalServerError)
+			}
+		},
+	)
+
+	t.Run(
+		"admin config and reload of an embedded app", func(t *testing.T) {
+			t.Setenv("APP_ADMIN_TOKEN", "s3cr3t")
+			t.Setenv("APP_MAINTENANCE_MODE", "false")
+			app := newTestApp(t, []string{"--app-port=0"}) // Not registered as the default config, unlike with Run
+			serve := func(method, path string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest(method, path, nil)
+				request.Header.Set("Authorization", "Bearer s3cr3t")
+				recorder := httptest.NewRecorder()
+				app.Handler().ServeHTTP(recorder, request)
+				return recorder
+			}
+			maintenanceMode := func() any {
+				var entries []core.ConfigEntry
+				response := serve(http.MethodGet, "/admin/config")
+				if err := json.Unmarshal(response.Body.Bytes(), &entries); err != nil {
+					t.Fatalf("GET /admin/config = %d %s: %v", response.Code, response.Body, err)
+				}
+				for _, entry := range entries {
+					if entry.Key == "APP_MAINTENANCE_MODE" {
+						return entry.Value
+					}
+				}
+				return nil
+			}
+
+			if got := maintenanceMode(); got != false {
+				t.Errorf("APP_MAINTENANCE_MODE of /admin/config = %v, want false", got)
+			}
+			t.Setenv("APP_MAINTENANCE_MODE", "true")
+			for _, applied := range []int{1, 0} { // Then nothing changed since the first reload
+				response := serve(http.MethodPost, "/admin/reload")
+				var result core.ReloadResult
+				if err := json.Unmarshal(response.Body.Bytes(), &result); err != nil || response.Code != http.StatusOK {
+					t.Fatalf("POST /admin/reload = %d %s, want 200", response.Code, response.Body)
+				}
+				if len(result.Applied) != applied {
+					t.Errorf("POST /admin/reload applied %+v, want %d change(s)", result.Applied, applied)
+				}
+			}
+			if got := maintenanceMode(); got != true {
+				t.Errorf("APP_MAINTENANCE_MODE of /admin/config after reload = %v, want true", got)
+			}
+			if response := serve(http.MethodGet, "/version"); response.Code != http.StatusServiceUnavailable {
+				t.Errorf("GET /version after reload = %d, want %d", response.Code, http.StatusServiceUnavailable)
+			}
+		},
+	)
+
+	t.Run(
+		"admin log level", func(t *testing.T) {
+			t.Setenv("APP_ADMIN_TOKEN", "s3cr3t")
+			config, err := core.LoadConfig(core.WithArgs([]string{"--app-admin-port=18001"}))
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			observed, _ := observer.New(zap.DebugLevel)
+			logger, middleware, err := core.CreateLogger(
+				config, zap.WrapCore(func(zapcore.Core) zapcore.Core { return observed }),
+			)
+			if err != nil {
+				t.Fatalf("CreateLogger() unexpected error: %v", err)
+			}
+			app, err := New(config, WithLogger(logger, *middleware))
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+
+			// In order, each one sees the levels set by the previous ones
+			tests := []struct {
+				name   string
+				method string
+				path   string
+				token  string
+				body   string
+				status int
+				// want is the level, configured level and whether a revert is pending of every logger returned
+				want *core.LogLevel
+			}{
+				{"no token", http.MethodGet, "/admin/log-level", "", "", http.StatusUnauthorized, nil},
+				{"wrong token", http.MethodPut, "/admin/log-level", "wrong", `{"level": "debug"}`, http.StatusUnauthorized, nil},
+				{"get all", http.MethodGet, "/admin/log-level", "s3cr3t", "", http.StatusOK, &core.LogLevel{Level: "info", Configured: "info"}},
+				{"get one", http.MethodGet, "/admin/log-level/default", "s3cr3t", "", http.StatusOK, &core.LogLevel{Level: "info", Configured: "info"}},
+				{"get unknown logger", http.MethodGet, "/admin/log-level/missing", "s3cr3t", "", http.StatusNotFound, nil},
+				{"set unknown logger", http.MethodPut, "/admin/log-level/missing", "s3cr3t", `{"level": "debug"}`, http.StatusNotFound, nil},
+				{"set unknown level", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{"level": "loud"}`, http.StatusBadRequest, nil},
+				{"invalid revert_after", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{"level": "debug", "revert_after": "soon"}`, http.StatusBadRequest, nil},
+				{"negative revert_after", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{"level": "debug", "revert_after": "-1m"}`, http.StatusBadRequest, nil},
+				{"no level", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{}`, http.StatusBadRequest, nil},
+				{
+					"set temporary", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{"level": "debug", "revert_after": "1h"}`,
+					http.StatusOK, &core.LogLevel{Level: "debug", Configured: "info", RevertsAt: &time.Time{}},
+				},
+				{
+					"set cancels the revert", http.MethodPut, "/admin/log-level/default", "s3cr3t", `{"level": "warn"}`,
+					http.StatusOK, &core.LogLevel{Level: "warn", Configured: "warn"},
+				},
+				{"set all", http.MethodPut, "/admin/log-level", "s3cr3t", `{"level": "error"}`, http.StatusOK, &core.LogLevel{Level: "error", Configured: "error"}},
+			}
+
+			for _, tt := range tests {
+				request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				if tt.token != "" {
+					request.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				recorder := httptest.NewRecorder()
+				app.AdminHandler().ServeHTTP(recorder, request)
+				if recorder.Code != tt.status {
+					t.Errorf("%s: %s %s = %d %s, want %d", tt.name, tt.method, tt.path, recorder.Code, recorder.Body, tt.status)
+					continue
+				}
+				if tt.want == nil {
+					continue
+				}
+
+				var levels []core.LogLevel
+				if strings.HasPrefix(recorder.Body.String(), "[") {
+					err = json.Unmarshal(recorder.Body.Bytes(), &levels)
+				} else {
+					levels = make([]core.LogLevel, 1)
+					err = json.Unmarshal(recorder.Body.Bytes(), &levels[0])
+				}
+				if err != nil || len(levels) == 0 {
+					t.Errorf("%s: response %s, error %v, want log levels", tt.name, recorder.Body, err)
+					continue
+				}
+				for _, level := range levels {
+					if level.Level != tt.want.Level || level.Configured != tt.want.Configured ||
+						(level.RevertsAt != nil) != (tt.want.RevertsAt != nil) {
+						t.Errorf("%s: %s %s = %+v, want %+v", tt.name, tt.method, tt.path, level, *tt.want)
+					}
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"unix socket", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.sock")
+			app := newTestApp(t, []string{"--app-listen=unix://" + path, "--app-listen-socket-mode=0600"})
+			if err := app.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+			if app.Addr() != path {
+				t.Errorf("Addr() = %v, want %v", app.Addr(), path)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat socket: %v", err)
+			}
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
+			}
+
+			client := &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, "unix", path)
+					},
+				},
+			}
+			response, err := client.Get("http://unix/ping")
+			if err != nil {
+				t.Fatalf("GET /ping unexpected error: %v", err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			_ = response.Body.Close()
+			if response.StatusCode != http.StatusOK || string(body) != "pong" {
+				t.Errorf("GET /ping = %d %q, want 200 \"pong\"", response.StatusCode, body)
+			}
+
+			if err := app.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop() unexpected error: %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("socket file still exists after Stop(), stat error: %v", err)
+			}
+		},
+	)
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+)
+
+// Exit codes of the any-business binary, so scripts can tell failures apart
+const (
+	ExitOK      = 0
+	ExitFailure = 1 // Runtime failure, e.g. the server crashed or the healthcheck failed
+	ExitUsage   = 2 // Unknown command or invalid arguments
+	// ExitUnavailable is returned when a command needs something that is not configured (sysexits EX_UNAVAILABLE)
+	ExitUnavailable = 69
+	// ExitConfig is returned when the config can't be loaded or is invalid (sysexits EX_CONFIG)
+	ExitConfig = 78
+)
+
+const cliName = "any-business"
+
+// command is a node of the command tree, either running itself or dispatching to its subcommands
+type command struct {
+	name        string
+	summary     string
+	run         func(cli *cli, args []string) int
+	subcommands []*command
+}
+
+// cli holds the global flags and the outputs shared by every command
+type cli struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	envFiles   []string
+	configFile string
+}
+
+var commands = []*command{
+	{name: "serve", summary: "start the HTTP server (default)", run: serve},
+	{
+		name: "config", summary: "inspect the resolved config", subcommands: []*command{
+			{name: "validate", summary: "check the config and report every problem", run: validateConfig},
+			{name: "print", summary: "print every config value with its source", run: printConfig},
+		},
+	},
+	{name: "version", summary: "print the version", run: printVersion},
+	{
+		name: "migrate", summary: "run the database migrations", subcommands: []*command{
+			{name: "up", summary: "apply the pending migrations", run: migrateUp},
+			{name: "down", summary: "revert the last migration", run: migrateDown},
+			{name: "status", summary: "list the applied and pending migrations", run: migrateStatus},
+		},
+	},
+	{name: "healthcheck", summary: "probe the server of this config, for container healthchecks", run: healthcheck},
+	{name: "routes", summary: "list the HTTP routes", run: printRoutes},
+}
+
+// Execute runs the command line args, without the program name, and returns the process exit code.
+// With no command the server is started.
+func Execute(args []string) int {
+	cli := &cli{stdout: os.Stdout, stderr: os.Stderr}
+	return cli.execute(args)
+}
+
+func (cli *cli) execute(args []string) int {
+	flags := flag.NewFlagSet(cliName, flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	flags.Usage = func() { cli.usage(cli.stderr, nil, commands) }
+	flags.Func(
+		"env-file", "load this .env file instead of the .env cascade, can be repeated", func(file string) error {
+			cli.envFiles = append(cli.envFiles, file)
+			return nil
+		},
+	)
+	flags.StringVar(&cli.configFile, "config", "", "path to a YAML, TOML or JSON config file (overrides "+core.ConfigFileEnvKey+")")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		return serve(cli, nil)
+	}
+	if args[0] == "help" {
+		cli.usage(cli.stdout, nil, commands)
+		return ExitOK
+	}
+	return cli.dispatch(nil, commands, args)
+}
+
+// dispatch finds the command named by args[0] among cmds and runs it with the remaining args
+func (cli *cli) dispatch(parents []string, cmds []*command, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(cli.stderr, "Missing command\n\n")
+		cli.usage(cli.stderr, parents, cmds)
+		return ExitUsage
+	}
+	if args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		cli.usage(cli.stdout, parents, cmds)
+		return ExitOK
+	}
+
+	for _, cmd := range cmds {
+		if cmd.name != args[0] {
+			continue
+		}
+		if cmd.run != nil {
+			return cmd.run(cli, args[1:])
+		}
+		return cli.dispatch(append(parents, cmd.name), cmd.subcommands, args[1:])
+	}
+
+	fmt.Fprintf(cli.stderr, "Unknown command '%s'\n\n", strings.Join(append(parents, args[0]), " "))
+	cli.usage(cli.stderr, parents, cmds)
+	return ExitUsage
+}
+
+func (cli *cli) usage(output io.Writer, parents []string, cmds []*command) {
+	name := strings.Join(append([]string{cliName}, parents...), " ")
+	if len(parents) == 0 {
+		fmt.Fprintf(output, "Usage: %s [--env-file FILE]... [--config FILE] <command> [flags]\n\n", name)
+	} else {
+		fmt.Fprintf(output, "Usage: %s <command> [flags]\n\n", name)
+	}
+
+	fmt.Fprintln(output, "Commands:")
+	for _, cmd := range cmds {
+		fmt.Fprintf(output, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	if len(parents) == 0 {
+		fmt.Fprintln(output, "\nGlobal flags:")
+		fmt.Fprintln(output, "  --env-file FILE  load this .env file instead of the .env cascade, can be repeated")
+		fmt.Fprintf(output, "  --config FILE    path to a YAML, TOML or JSON config file (overrides %s)\n", core.ConfigFileEnvKey)
+		fmt.Fprintf(output, "\nExit codes: %d ok, %d failure, %d usage, %d unavailable, %d invalid config\n",
+			ExitOK, ExitFailure, ExitUsage, ExitUnavailable, ExitConfig)
+	}
+	fmt.Fprintf(output, "\nRun '%s <command> --help' for the flags of a command.\n", name)
+}
+
+// newFlagSet returns the flag set of a command, printing its usage and errors to stderr
+func (cli *cli) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cliName+" "+name, flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	return flags
+}
+
+// loadDotEnv loads the --env-file files, or the optional .env cascade when none is given
+func (cli *cli) loadDotEnv() ([]string, error) {
+	if len(cli.envFiles) > 0 {
+		return core.LoadDotEnv(cli.envFiles...)
+	}
+	return core.LoadDotEnvCascade()
+}
+
+// loadConfig loads the .env files then resolves the config, parsing args with flags along
+// with the per-key config flags
+func (cli *cli) loadConfig(flags *flag.FlagSet, args []string) (*core.Config, []string, error) {
+	envFiles, err := cli.loadDotEnv()
+	if err != nil {
+		return nil, nil, &core.ConfigError{Problems: []error{fmt.Errorf("error loading .env files: %w", err)}}
+	}
+
+	opts := []core.ConfigOption{core.WithArgs(args), core.WithFlagSet(flags)}
+	if cli.configFile != "" {
+		opts = append(opts, core.WithConfigFile(cli.configFile))
+	}
+	config, err := core.LoadConfig(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, envFiles, nil
+}
+
+// exitCode prints err and returns the matching exit code, flag.ErrHelp is a success. Flag errors are
+// already printed, along with the usage, by the flag set of the command, see newFlagSet.
+func (cli *cli) exitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	var flagErr *core.FlagError
+	if errors.As(err, &flagErr) {
+		return ExitUsage
+	}
+	fmt.Fprintln(cli.stderr, err.Error())
+
+	var configErr *core.ConfigError
+	if errors.As(err, &configErr) {
+		return ExitConfig
+	}
+	return ExitFailure
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		stdout   string
+		stderr   string
+	}{
+		{"help", []string{"help"}, ExitOK, "Usage: any-business", ""},
+		{"subcommand help", []string{"config", "--help"}, ExitOK, "Usage: any-business config", ""},
+		{"unknown command", []string{"nope"}, ExitUsage, "", "Unknown command 'nope'"},
+		{"missing subcommand", []string{"migrate"}, ExitUsage, "", "Missing command"},
+		{"unknown global flag", []string{"--nope", "version"}, ExitUsage, "", "flag provided but not defined"},
+		{"config validate", []string{"config", "validate"}, ExitOK, "Config is valid (environment: testing", ""},
+		{"unknown subcommand flag", []string{"config", "validate", "--nope"}, ExitUsage, "", "flag provided but not defined"},
+		{"unknown healthcheck flag", []string{"healthcheck", "--nope"}, ExitUsage, "", "flag provided but not defined"},
+		{"invalid config", []string{"config", "validate", "--app-port=70000"}, ExitConfig, "", "APP_PORT"},
+		{"missing env file", []string{"--env-file", "missing.env", "config", "validate"}, ExitConfig, "", "missing.env"},
+		{"version", []string{"version"}, ExitOK, "AnyBusiness (testings) 0.0.0.dev", ""},
+		{"migrate without database", []string{"migrate", "status"}, ExitUnavailable, "", "no database is configured"},
+		{"routes", []string{"routes"}, ExitOK, "GET     /ready", ""},
+		{"healthcheck unreachable", []string{"healthcheck", "--addr=unix:///nonexistent.sock", "--timeout=1s"}, ExitFailure, "", "Unhealthy"},
+		{"healthcheck exclusive flags", []string{"healthcheck", "--ready", "--alive"}, ExitUsage, "", "mutually exclusive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				cli := &cli{stdout: &stdout, stderr: &stderr}
+
+				if got := cli.execute(tt.args); got != tt.exitCode {
+					t.Errorf("execute(%v) = %v, want %v, stderr: %s", tt.args, got, tt.exitCode, stderr.String())
+				}
+				if !strings.Contains(stdout.String(), tt.stdout) {
+					t.Errorf("execute(%v) stdout = %q, want it to contain %q", tt.args, stdout.String(), tt.stdout)
+				}
+				if !strings.Contains(stderr.String(), tt.stderr) {
+					t.Errorf("execute(%v) stderr = %q, want it to contain %q", tt.args, stderr.String(), tt.stderr)
+				}
+			},
+		)
+	}
+}
+
+func TestExecuteUnknownFlag(t *testing.T) {
+	commands := [][]string{
+		{"serve"},
+		{"config", "validate"},
+		{"config", "print"},
+		{"version"},
+		{"migrate", "up"},
+		{"migrate", "down"},
+		{"migrate", "status"},
+		{"healthcheck"},
+		{"routes"},
+	}
+
+	for _, command := range commands {
+		t.Run(
+			strings.Join(command, " "), func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				cli := &cli{stdout: &stdout, stderr: &stderr}
+
+				args := append(command, "--nope")
+				if got := cli.execute(args); got != ExitUsage {
+					t.Errorf("execute(%v) = %v, want %v, stderr: %s", args, got, ExitUsage, stderr.String())
+				}
+				if count := strings.Count(stderr.String(), "flag provided but not defined: -nope"); count != 1 {
+					t.Errorf("execute(%v) stderr reports the unknown flag %d times, want once: %q", args, count, stderr.String())
+				}
+				if !strings.Contains(stderr.String(), "Usage of any-business "+command[0]) {
+					t.Errorf("execute(%v) stderr = %q, want the usage of the command", args, stderr.String())
+				}
+			},
+		)
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	startApp := func(t *testing.T, args []string) *App {
+		app := newTestApp(t, args)
+		if err := app.Start(context.Background()); err != nil {
+			t.Fatalf("Start() unexpected error: %v", err)
+		}
+		t.Cleanup(
+			func() {
+				if err := app.Stop(context.Background()); err != nil {
+					t.Errorf("Stop() unexpected error: %v", err)
+				}
+			},
+		)
+		return app
+	}
+	tcpApp := startApp(t, []string{"--app-port=0"})
+	unixApp := startApp(t, []string{"--app-listen=unix://" + filepath.Join(t.TempDir(), "app.sock")})
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdout string
+	}{
+		{"ready", []string{"--addr=" + tcpApp.Addr()}, "Healthy: /ready returned 200"},
+		{"alive", []string{"--addr=" + tcpApp.Addr(), "--alive"}, "Healthy: /alive returned 200"},
+		{"unix socket", []string{"--addr=unix://" + unixApp.Addr()}, "Healthy: /ready returned 200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				cli := &cli{stdout: &stdout, stderr: &stderr}
+
+				args := append([]string{"healthcheck", "--timeout=5s"}, tt.args...)
+				if got := cli.execute(args); got != ExitOK {
+					t.Errorf("execute(%v) = %v, want %v, stderr: %s", args, got, ExitOK, stderr.String())
+				}
+				if !strings.Contains(stdout.String(), tt.stdout) {
+					t.Errorf("execute(%v) stdout = %q, want it to contain %q", args, stdout.String(), tt.stdout)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+)
+
+// validateConfig resolves the config like serve does and reports every problem found
+func validateConfig(cli *cli, args []string) int {
+	flags := cli.newFlagSet("config validate")
+	config, envFiles, err := cli.loadConfig(flags, args)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+
+	fmt.Fprintf(cli.stdout, "Config is valid (environment: %s, env files: %v)\n", config.Env, envFiles)
+	return ExitOK
+}
+
+// printConfig resolves the config like serve does and prints every value along with its
+// source (default, file, env or flag) as JSON or YAML, secrets are redacted
+func printConfig(cli *cli, args []string) int {
+	flags := cli.newFlagSet("config print")
+	format := flags.String("format", "json", "output format, json or yaml")
+
+	config, _, err := cli.loadConfig(flags, args)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+
+	var content []byte
+	switch *format {
+	case "json":
+		content, err = json.MarshalIndent(config.Entries(), "", "  ")
+	case "yaml":
+		content, err = yaml.Marshal(config.Entries())
+	default:
+		fmt.Fprintf(cli.stderr, "Unknown format '%s', expected json or yaml\n", *format)
+		return ExitUsage
+	}
+	if err != nil {
+		fmt.Fprintf(cli.stderr, "Error encoding config: %s\n", err.Error())
+		return ExitFailure
+	}
+
+	_, _ = fmt.Fprintln(cli.stdout, string(content))
+	return ExitOK
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Build metadata stamped at build time, see the build target of the Makefile:
+//
+//	go build -ldflags "-X github.com/Koubae/GoAnyBusiness/internal/app/core.version=1.2.3 \
+//	  -X github.com/Koubae/GoAnyBusiness/internal/app/core.commit=$(git rev-parse HEAD) \
+//	  -X github.com/Koubae/GoAnyBusiness/internal/app/core.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When not stamped they fall back to the module version and VCS info embedded by the go toolchain.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// Unknown is the value of the build metadata that could not be resolved
+const Unknown = "unknown"
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	// Modified is true when the binary was built from a checkout with uncommitted changes, only known without ldflags
+	Modified bool `json:"modified,omitempty"`
+}
+
+var getBuildInfo = sync.OnceValue(
+	func() BuildInfo {
+		info := BuildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+			Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		}
+
+		if buildInfo, ok := debug.ReadBuildInfo(); ok {
+			if info.Version == "" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+				info.Version = buildInfo.Main.Version
+			}
+			for _, setting := range buildInfo.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					if info.Commit == "" {
+						info.Commit = setting.Value
+					}
+				case "vcs.time":
+					if info.BuildDate == "" {
+						info.BuildDate = setting.Value
+					}
+				case "vcs.modified":
+					info.Modified = setting.Value == "true"
+				}
+			}
+		}
+
+		for _, field := range []*string{&info.Version, &info.Commit, &info.BuildDate} {
+			if *field == "" {
+				*field = Unknown
+			}
+		}
+		return info
+	},
+)
+
+// GetBuildInfo returns the build metadata from ldflags, falling back to runtime/debug.ReadBuildInfo
+func GetBuildInfo() BuildInfo {
+	return getBuildInfo()
+}
@@ -1,11 +1,18 @@
 package core
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Koubae/GoAnyBusiness/pkg/utils"
 )
@@ -32,59 +39,313 @@ var (
 )
 
 // Config represents the application config
+//
+// Fields tagged `reload:"true"` are applied at runtime by ReloadConfig, any other change needs a restart.
+// Fields tagged `secret:"true"` are redacted whenever the config is printed or logged, and like any
+// other key can be read from a file with KEY_FILE=/run/secrets/key or KEY=file:///run/secrets/key.
+// AppVersion defaults to the version stamped at build time when known, see GetBuildInfo.
 type Config struct {
-	Env            Environment
-	TrustedProxies []string
-	host           string
-	port           uint16
-	AppName        string
-	AppVersion     string
-	AppLogLevel    string
+	Env            Environment `json:"environment" env:"APP_ENVIRONMENT" default:"development"`
+	TrustedProxies []string    `json:"trusted_proxies" env:"APP_NETWORKING_PROXIES" reload:"true"`
+	Host           string      `json:"host" env:"APP_HOST" default:"http://localhost"`
+	Port           uint16      `json:"port" env:"APP_PORT" default:"8001"` // 0 picks a free port, see App.Addr
+	AppName        string      `json:"app_name" env:"APP_NAME" default:"unknown"`
+	AppVersion     string      `json:"app_version" env:"APP_VERSION" default:"unknown"`
+	AppLogLevel    string      `json:"log_level" env:"APP_LOG_LEVEL" default:"INFO" reload:"true"`
+	// AppLogLevels overrides APP_LOG_LEVEL per named logger, e.g. orders=debug,http=warn, see NamedLogger
+	AppLogLevels map[string]string `json:"log_levels" env:"APP_LOG_LEVELS" reload:"true"`
+
+	// Listen serves on a Unix socket instead of APP_PORT, e.g. unix:///run/any-business.sock
+	Listen string `json:"listen" env:"APP_LISTEN"`
+	// SocketMode is the octal permission of the Unix socket file, SocketGroup its group name or id
+	SocketMode  string `json:"socket_mode" env:"APP_LISTEN_SOCKET_MODE" default:"0660"`
+	SocketGroup string `json:"socket_group" env:"APP_LISTEN_SOCKET_GROUP"`
+
+	CORSAllowOrigins []string `json:"cors_allow_origins" env:"APP_CORS_ALLOW_ORIGINS" reload:"true"`
+	// RateLimitRPS is the number of requests per second allowed per client IP, 0 disables rate limiting
+	RateLimitRPS    float64 `json:"rate_limit_rps" env:"APP_RATE_LIMIT_RPS" default:"0" reload:"true"`
+	RateLimitBurst  int     `json:"rate_limit_burst" env:"APP_RATE_LIMIT_BURST" default:"20" reload:"true"`
+	MaintenanceMode bool    `json:"maintenance_mode" env:"APP_MAINTENANCE_MODE" reload:"true"`
+	// AdminToken is the bearer token required by the /admin endpoints, which are disabled when empty
+	AdminToken string `json:"admin_token" env:"APP_ADMIN_TOKEN" secret:"true"`
+	// AdminPort moves the health probes and admin endpoints, along with metrics and pprof, to a second
+	// listener meant to stay internal, 0 keeps the probes and admin endpoints on APP_PORT
+	AdminPort uint16 `json:"admin_port" env:"APP_ADMIN_PORT"`
+
+	Server ServerConfig `json:"server" prefix:"APP_SERVER_"`
+	TLS    TLSConfig    `json:"tls" prefix:"APP_TLS_"`
+
+	sources     map[string]utils.Source
+	loadOptions []ConfigOption
+	// origin is the config as loaded by LoadConfig, the configs reloaded from it keep it
+	origin *Config
+}
+
+// ServerConfig holds the HTTP server timeouts and limits, the `default` tags apply to staging and
+// production while environmentDefaults overrides some of them in development and testing
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration  `json:"read_header_timeout" env:"READ_HEADER_TIMEOUT" default:"5s"`
+	ReadTimeout       time.Duration  `json:"read_timeout" env:"READ_TIMEOUT" default:"15s"`
+	WriteTimeout      time.Duration  `json:"write_timeout" env:"WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration  `json:"idle_timeout" env:"IDLE_TIMEOUT" default:"120s"`
+	MaxBodySize       utils.ByteSize `json:"max_body_size" env:"MAX_BODY_SIZE" default:"8MiB"`
+	// DrainPeriod is how long the server keeps serving once shutdown starts while /ready fails,
+	// so load balancers stop routing new traffic before the listener is closed
+	DrainPeriod time.Duration `json:"drain_period" env:"DRAIN_PERIOD" default:"5s"`
+	// ShutdownTimeout is how long in-flight requests are given to complete on shutdown
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"10s"`
+	// UpgradeTimeout is how long the new process started by SIGUSR2 is given to serve, see App.Upgrade
+	UpgradeTimeout time.Duration `json:"upgrade_timeout" env:"UPGRADE_TIMEOUT" default:"30s"`
+}
+
+// TLSConfig enables HTTPS when CertPath and KeyPath are set. The certificate, key and client CA files
+// are reloaded when they change on disk, so rotated certificates are picked up without a restart.
+// Keys end in _PATH rather than _FILE, which would read the value from a file, see utils.LookupEnv.
+type TLSConfig struct {
+	CertPath string `json:"cert_path" env:"CERT_PATH"`
+	KeyPath  string `json:"key_path" env:"KEY_PATH"`
+	// MinVersion is the minimum TLS version accepted, 1.2 or 1.3
+	MinVersion string `json:"min_version" env:"MIN_VERSION" default:"1.2"`
+	// ClientCAPath enables mTLS, clients must present a certificate signed by one of these CAs
+	ClientCAPath string `json:"client_ca_path" env:"CLIENT_CA_PATH"`
+	// ReloadInterval is how often the files are checked for changes, on the next TLS handshake
+	ReloadInterval time.Duration `json:"reload_interval" env:"RELOAD_INTERVAL" default:"30s"`
+	// RedirectPort starts a plain HTTP listener redirecting every request to HTTPS, 0 disables it
+	RedirectPort uint16 `json:"redirect_port" env:"REDIRECT_PORT"`
+	// HTTP3 also serves HTTP/3 over QUIC on the UDP port of APP_PORT, advertised by Alt-Svc headers
+	HTTP3 bool `json:"http3" env:"HTTP3"`
+}
+
+// TLSVersions are the accepted values of APP_TLS_MIN_VERSION
+var TLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Enabled tells whether HTTPS is configured
+func (c *TLSConfig) Enabled() bool {
+	return c.CertPath != "" || c.KeyPath != ""
+}
+
+// environmentDefaults overrides the `default` tags per environment, keyed by env key
+var environmentDefaults = map[Environment]map[string]string{
+	Testing: {
+		"APP_SERVER_DRAIN_PERIOD":     "0s",
+		"APP_SERVER_SHUTDOWN_TIMEOUT": "1s",
+	},
+	Development: {
+		"APP_SERVER_WRITE_TIMEOUT":    "5m", // Leave time to step through a request in a debugger
+		"APP_SERVER_DRAIN_PERIOD":     "0s",
+		"APP_SERVER_SHUTDOWN_TIMEOUT": "2s",
+	},
+}
+
+// ConfigError lists every problem found while loading the config
+type ConfigError struct {
+	Problems []error
+}
+
+func (e *ConfigError) Error() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "invalid config, %d problem(s) found:", len(e.Problems))
+	for _, problem := range e.Problems {
+		builder.WriteString("\n  - ")
+		builder.WriteString(problem.Error())
+	}
+	return builder.String()
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return e.Problems
+}
+
+// FlagError is a command line argument that can't be parsed, like an unknown flag, as opposed to a
+// ConfigError which is a value that doesn't validate. The flag set has already printed it to its output.
+type FlagError struct {
+	Err error
+}
+
+func (e *FlagError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FlagError) Unwrap() error {
+	return e.Err
 }
 
 // NewConfig creates a new config
 func NewConfig(configName string) *Config {
+	config, err := LoadConfig()
+	if err != nil {
+		panic(fmt.Sprintf("Error loading config '%s', error: %s", configName, err.Error()))
+	}
+	if err := RegisterConfig(configName, config); err != nil {
+		panic(err.Error())
+	}
+	return config
+}
+
+// RegisterConfig registers a loaded config under the given name
+func RegisterConfig(configName string, config *Config) error {
 	configLock.Lock()
 	defer configLock.Unlock()
 
 	_, ok := configsSingletonMapping[configName]
 	if ok {
-		panic(fmt.Sprintf("Config '%s' already exists", configName))
+		return fmt.Errorf("config '%s' already exists", configName)
 	}
 
-	host := utils.GetEnvString("APP_HOST", "http://localhost")
-	port := utils.GetEnvInt("APP_PORT", 8001)
-
-	err := os.Setenv("PORT", strconv.Itoa(port)) // For gin-gonic
+	err := os.Setenv("PORT", strconv.Itoa(int(config.Port))) // For gin-gonic
 	if err != nil {
-		panic(fmt.Sprintf("Error setting Gin env PORT '%v', error: %s", port, err.Error()))
+		return fmt.Errorf("error setting Gin env PORT '%v', error: %s", config.Port, err.Error())
 	}
 
-	appName := utils.GetEnvString("APP_NAME", "unknown")
-	appVersion := utils.GetEnvString("APP_VERSION", "unknown")
-	appLogLevel := utils.GetEnvString("APP_LOG_LEVEL", "INFO")
+	configsSingletonMapping[configName] = config
+	return nil
+}
 
-	environment := Environment(utils.GetEnvString("APP_ENVIRONMENT", "development"))
-	if !slices.Contains(Envs[:], environment) {
-		panic(fmt.Sprintf("Invalid environment: '%s', supported envs are %v", environment, Envs))
+// Validate checks the config values and returns every problem found
+func (c *Config) Validate() []*utils.EnvError {
+	var problems []*utils.EnvError
+	if !slices.Contains(Envs[:], c.Env) {
+		problems = append(problems, newConfigProblem("APP_ENVIRONMENT", c.Env, fmt.Sprintf("supported envs are %v", Envs)))
+	}
+	if _, ok := parseLogLevel(c.AppLogLevel); !ok {
+		problems = append(problems, newConfigProblem("APP_LOG_LEVEL", c.AppLogLevel, "unknown log level"))
 	}
-	trustedProxies := utils.GetEnvStringSlice("APP_NETWORKING_PROXIES", []string{})
+	for _, name := range slices.Sorted(maps.Keys(c.AppLogLevels)) {
+		if _, ok := parseLogLevel(c.AppLogLevels[name]); !ok {
+			problems = append(problems, newConfigProblem("APP_LOG_LEVELS", name+"="+c.AppLogLevels[name], "unknown log level"))
+		}
+	}
+	for _, proxy := range c.TrustedProxies {
+		if !isIPOrCIDR(proxy) {
+			problems = append(problems, newConfigProblem("APP_NETWORKING_PROXIES", proxy, "not a valid IP or CIDR"))
+		}
+	}
+	for _, origin := range c.CORSAllowOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			problems = append(problems, newConfigProblem("APP_CORS_ALLOW_ORIGINS", origin, "must be '*' or start with http:// or https://"))
+		}
+	}
+	if c.RateLimitRPS < 0 {
+		problems = append(problems, newConfigProblem("APP_RATE_LIMIT_RPS", c.RateLimitRPS, "must not be negative"))
+	}
+	if c.RateLimitRPS > 0 && c.RateLimitBurst < 1 {
+		problems = append(problems, newConfigProblem("APP_RATE_LIMIT_BURST", c.RateLimitBurst, "must be at least 1 when rate limiting is enabled"))
+	}
+	if c.AdminPort != 0 && (c.AdminPort == c.Port || c.AdminPort == c.TLS.RedirectPort) {
+		problems = append(problems, newConfigProblem("APP_ADMIN_PORT", c.AdminPort, "must differ from APP_PORT and APP_TLS_REDIRECT_PORT"))
+	}
+	if c.Listen != "" {
+		if path, ok := strings.CutPrefix(c.Listen, "unix://"); !ok || !filepath.IsAbs(path) {
+			problems = append(problems, newConfigProblem("APP_LISTEN", c.Listen, "must be a unix:// URL with an absolute path, e.g. unix:///run/any-business.sock"))
+		}
+		if c.TLS.HTTP3 {
+			problems = append(problems, newConfigProblem("APP_TLS_HTTP3", c.TLS.HTTP3, "needs a UDP port, not available with APP_LISTEN"))
+		}
+	}
+	if _, err := c.GetSocketMode(); err != nil {
+		problems = append(problems, newConfigProblem("APP_LISTEN_SOCKET_MODE", c.SocketMode, "must be an octal permission, e.g. 0660"))
+	}
+	problems = append(problems, c.Server.validate()...)
+	return append(problems, c.TLS.validate(c.Port)...)
+}
 
-	config := &Config{
-		Env:            environment,
-		TrustedProxies: trustedProxies,
-		host:           host,
-		port:           uint16(port),
-		AppName:        appName,
-		AppVersion:     appVersion,
-		AppLogLevel:    appLogLevel,
+func (c *TLSConfig) validate(port uint16) []*utils.EnvError {
+	var problems []*utils.EnvError
+	if c.Enabled() && c.CertPath == "" {
+		problems = append(problems, newConfigProblem("APP_TLS_CERT_PATH", c.CertPath, "required when APP_TLS_KEY_PATH is set"))
 	}
-	configsSingletonMapping[configName] = config
-	return config
+	if c.Enabled() && c.KeyPath == "" {
+		problems = append(problems, newConfigProblem("APP_TLS_KEY_PATH", c.KeyPath, "required when APP_TLS_CERT_PATH is set"))
+	}
+	if _, ok := TLSVersions[c.MinVersion]; !ok {
+		problems = append(problems, newConfigProblem("APP_TLS_MIN_VERSION", c.MinVersion, "must be 1.2 or 1.3"))
+	}
+	if c.ClientCAPath != "" && !c.Enabled() {
+		problems = append(problems, newConfigProblem("APP_TLS_CLIENT_CA_PATH", c.ClientCAPath, "requires APP_TLS_CERT_PATH and APP_TLS_KEY_PATH"))
+	}
+	if c.ReloadInterval <= 0 {
+		problems = append(problems, newConfigProblem("APP_TLS_RELOAD_INTERVAL", c.ReloadInterval, "must be positive"))
+	}
+	if c.RedirectPort != 0 && !c.Enabled() {
+		problems = append(problems, newConfigProblem("APP_TLS_REDIRECT_PORT", c.RedirectPort, "requires APP_TLS_CERT_PATH and APP_TLS_KEY_PATH"))
+	}
+	if c.HTTP3 && !c.Enabled() {
+		problems = append(problems, newConfigProblem("APP_TLS_HTTP3", c.HTTP3, "requires APP_TLS_CERT_PATH and APP_TLS_KEY_PATH"))
+	}
+	if c.RedirectPort != 0 && c.RedirectPort == port {
+		problems = append(problems, newConfigProblem("APP_TLS_REDIRECT_PORT", c.RedirectPort, "must differ from APP_PORT"))
+	}
+	return problems
+}
+
+func (c *ServerConfig) validate() []*utils.EnvError {
+	var problems []*utils.EnvError
+	if c.ReadHeaderTimeout <= 0 {
+		problems = append(problems, newConfigProblem("APP_SERVER_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout, "must be positive"))
+	}
+	// A shutdown timeout of 0 would close every in-flight request at once
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, newConfigProblem("APP_SERVER_SHUTDOWN_TIMEOUT", c.ShutdownTimeout, "must be positive"))
+	}
+	timeouts := []struct {
+		key    string
+		value  time.Duration
+		reason string
+	}{
+		{"APP_SERVER_READ_TIMEOUT", c.ReadTimeout, "must not be negative, use 0 for no timeout"},
+		{"APP_SERVER_WRITE_TIMEOUT", c.WriteTimeout, "must not be negative, use 0 for no timeout"},
+		{"APP_SERVER_IDLE_TIMEOUT", c.IdleTimeout, "must not be negative, use 0 for APP_SERVER_READ_TIMEOUT"},
+		{"APP_SERVER_DRAIN_PERIOD", c.DrainPeriod, "must not be negative, use 0 to skip draining"},
+		{"APP_SERVER_UPGRADE_TIMEOUT", c.UpgradeTimeout, "must not be negative, use 0 for no timeout"},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			problems = append(problems, newConfigProblem(timeout.key, timeout.value, timeout.reason))
+		}
+	}
+	if c.MaxBodySize <= 0 {
+		problems = append(problems, newConfigProblem("APP_SERVER_MAX_BODY_SIZE", c.MaxBodySize, "must be positive"))
+	}
+	return problems
+}
+
+func newConfigProblem(key string, value any, reason string) *utils.EnvError {
+	return &utils.EnvError{Key: key, Value: fmt.Sprint(value), Err: errors.New(reason)}
+}
+
+func hasProblemForKey(problems []error, key string) bool {
+	for _, problem := range problems {
+		var envErr *utils.EnvError
+		if errors.As(problem, &envErr) && envErr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPOrCIDR(s string) bool {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
 }
 
 // GetConfig returns a config by name
 func GetConfig(configName string) *Config {
+	configLock.Lock()
+	defer configLock.Unlock()
+
 	config, ok := configsSingletonMapping[configName]
 	if !ok {
 		panic(fmt.Sprintf("Config '%s' does not exist", configName))
@@ -99,10 +360,81 @@ func GetDefaultConfig() *Config {
 
 // GetAddr returns the address of the server
 func (c Config) GetAddr() string {
-	return fmt.Sprintf(":%d", c.port)
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// GetListenAddr returns the network and address the server listens on, the Unix socket of APP_LISTEN
+// or TCP on APP_PORT
+func (c Config) GetListenAddr() (string, string) {
+	if path, ok := strings.CutPrefix(c.Listen, "unix://"); ok {
+		return "unix", path
+	}
+	return "tcp", c.GetAddr()
+}
+
+// GetSocketMode returns the permission of the Unix socket file of APP_LISTEN
+func (c Config) GetSocketMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.SocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode '%s'", c.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// GetAdminAddr returns the address of the admin server, empty when APP_ADMIN_PORT is not set
+func (c Config) GetAdminAddr() string {
+	if c.AdminPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", c.AdminPort)
+}
+
+// Sources returns the layer (default, file, env or flag) each config key was resolved from
+func (c Config) Sources() map[string]utils.Source {
+	return maps.Clone(c.sources)
+}
+
+// ConfigEntry is a resolved config value along with the layer it came from
+type ConfigEntry struct {
+	Key    string       `json:"key"`
+	Path   string       `json:"path"`
+	Value  any          `json:"value"`
+	Source utils.Source `json:"source"`
+	Secret bool         `json:"secret,omitempty"`
+}
+
+// Entries returns every config value with its source, secrets are redacted
+func (c *Config) Entries() []ConfigEntry {
+	fields, err := utils.DescribeFields(c)
+	if err != nil {
+		panic(fmt.Sprintf("Error describing config, error: %s", err.Error()))
+	}
+
+	entries := make([]ConfigEntry, 0, len(fields))
+	for _, field := range fields {
+		source, ok := c.sources[field.Key]
+		if !ok {
+			source = utils.SourceUnset
+		}
+		entries = append(
+			entries, ConfigEntry{
+				Key:    field.Key,
+				Path:   field.Path,
+				Value:  field.Value,
+				Source: source,
+				Secret: field.Secret,
+			},
+		)
+	}
+	return entries
+}
+
+// String renders the config with secrets redacted, so it is safe to log
+func (c Config) String() string {
+	return utils.FormatFields(&c)
 }
 
 // GetURL returns the URL of the server
 func (c Config) GetURL() string {
-	return fmt.Sprintf("%s:%d", c.host, c.port)
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"errors"
+	"flag"
+	"io"
+
+	"github.com/Koubae/GoAnyBusiness/pkg/utils"
+)
+
+// ConfigFileEnvKey is the env var pointing to the optional config file, overridden by --config
+const ConfigFileEnvKey = "APP_CONFIG_FILE"
+
+// ConfigOption customizes how LoadConfig resolves the config
+type ConfigOption func(*configLoader)
+
+type configLoader struct {
+	file   string
+	args   []string
+	output io.Writer
+	flags  *flag.FlagSet
+}
+
+// WithConfigFile sets the config file to load, taking precedence over APP_CONFIG_FILE
+func WithConfigFile(path string) ConfigOption {
+	return func(loader *configLoader) {
+		loader.file = path
+	}
+}
+
+// WithArgs sets the command line arguments parsed for --config and per-key flags
+func WithArgs(args []string) ConfigOption {
+	return func(loader *configLoader) {
+		loader.args = args
+	}
+}
+
+// WithFlagOutput sets where flag usage and parse errors are printed, discarded by default
+func WithFlagOutput(output io.Writer) ConfigOption {
+	return func(loader *configLoader) {
+		loader.output = output
+	}
+}
+
+// WithFlagSet registers the config flags on flags instead of a new flag set,
+// so callers can parse their own flags alongside them
+func WithFlagSet(flags *flag.FlagSet) ConfigOption {
+	return func(loader *configLoader) {
+		loader.flags = flags
+	}
+}
+
+// LoadConfig resolves the config from layered sources and validates it.
+//
+// Precedence, from lowest to highest:
+//  1. `default` struct tags, overridden per environment by environmentDefaults and, for APP_VERSION,
+//     by the version stamped at build time
+//  2. the config file (YAML, TOML or JSON by extension) given by --config or APP_CONFIG_FILE
+//  3. environment variables
+//  4. command line flags, named after the env key (APP_PORT -> --app-port)
+//
+// All problems are returned at once as a *ConfigError; flag.ErrHelp is returned as-is and other
+// flag parsing errors as a *FlagError.
+func LoadConfig(opts ...ConfigOption) (*Config, error) {
+	loader := &configLoader{output: io.Discard}
+	for _, opt := range opts {
+		opt(loader)
+	}
+
+	config := &Config{}
+	binder, err := utils.NewBinder(config)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := loader.flags
+	if flags == nil {
+		flags = flag.NewFlagSet("any-business", flag.ContinueOnError)
+		flags.SetOutput(loader.output)
+	}
+	configFile := flags.String("config", "", "path to a YAML, TOML or JSON config file (overrides "+ConfigFileEnvKey+")")
+	binder.RegisterFlags(flags)
+	if err := flags.Parse(loader.args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &FlagError{Err: err}
+	}
+
+	var problems []error
+	binder.ApplyDefaults()
+	if file, err := loader.resolveFile(*configFile); err != nil {
+		problems = append(problems, err)
+	} else if file != "" {
+		values, err := utils.ReadConfigFile(file)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			binder.ApplyValues(values, utils.SourceFile)
+		}
+	}
+	binder.ApplyEnv()
+	binder.ApplyFlags(flags)
+	binder.OverrideDefaults(environmentDefaults[config.Env])
+	if build := GetBuildInfo(); build.Version != Unknown {
+		binder.OverrideDefaults(map[string]string{"APP_VERSION": build.Version})
+	}
+
+	if err := binder.Err(); err != nil {
+		problems = append(problems, unwrapErrors(err)...)
+	}
+	for _, problem := range config.Validate() {
+		if !hasProblemForKey(problems, problem.Key) {
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	config.sources = binder.Sources()
+	config.loadOptions = loader.reloadOptions(*configFile, binder.FlagArgs(flags))
+	config.origin = config
+	return config, nil
+}
+
+// reloadOptions returns the options resolving the same sources again on reload, with only
+// the config flags kept as args, since the flag set may hold flags of the caller
+func (loader *configLoader) reloadOptions(configFile string, flagArgs []string) []ConfigOption {
+	if configFile != "" {
+		flagArgs = append(flagArgs, "--config="+configFile)
+	}
+	return []ConfigOption{WithConfigFile(loader.file), WithArgs(flagArgs)}
+}
+
+func (loader *configLoader) resolveFile(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if loader.file != "" {
+		return loader.file, nil
+	}
+	return utils.GetEnvStringE(ConfigFileEnvKey, "")
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/Koubae/GoAnyBusiness/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	reloadLock  sync.Mutex
+	reloadHooks []*reloadHook
+)
+
+// reloadHook is called with the reloaded configs of origin, of every config when nil
+type reloadHook struct {
+	origin *Config
+	hook   func(*Config)
+}
+
+// ReloadResult lists the changes found by Reload
+type ReloadResult struct {
+	Applied  []utils.FieldChange `json:"applied"`
+	Rejected []utils.FieldChange `json:"rejected"`
+}
+
+// Log writes the applied and rejected changes to logger
+func (r *ReloadResult) Log(logger *zap.SugaredLogger) {
+	if len(r.Applied) == 0 && len(r.Rejected) == 0 {
+		logger.Infof("Config reloaded, nothing changed")
+		return
+	}
+	for _, change := range r.Applied {
+		logger.Infof("Config reloaded, %s changed: '%s' -> '%s'", change.Key, change.Old, change.New)
+	}
+	for _, change := range r.Rejected {
+		logger.Warnf("Config reload rejected %s change '%s' -> '%s', a restart is required", change.Key, change.Old, change.New)
+	}
+}
+
+// OnConfigReload registers a hook called with the updated config every time Reload applies changes, to any config
+func OnConfigReload(hook func(*Config)) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	reloadHooks = append(reloadHooks, &reloadHook{hook: hook})
+}
+
+// OnConfigReloadOf registers a hook called with the updated config every time Reload applies changes to
+// config or to a config reloaded from it. The returned function removes the hook.
+func OnConfigReloadOf(config *Config, hook func(*Config)) func() {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	registered := &reloadHook{origin: config.origin, hook: hook}
+	if registered.origin == nil {
+		registered.origin = config // Not loaded by LoadConfig, so never reloaded
+	}
+	reloadHooks = append(reloadHooks, registered)
+	return func() {
+		reloadLock.Lock()
+		defer reloadLock.Unlock()
+
+		reloadHooks = slices.DeleteFunc(reloadHooks, func(h *reloadHook) bool { return h == registered })
+	}
+}
+
+// ReloadConfig reloads the named config, see Reload
+func ReloadConfig(configName string) (*ReloadResult, error) {
+	_, result, err := Reload(GetConfig(configName))
+	return result, err
+}
+
+// Reload re-reads the .env files and the config sources of current and applies the changes that are safe
+// at runtime, the fields tagged `reload:"true"`, to a copy of it, which it returns and which replaces current
+// where it is registered. Changes needing a restart, like APP_PORT, are rejected and keep their current value.
+func Reload(current *Config) (*Config, *ReloadResult, error) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	if _, err := ReloadDotEnv(); err != nil {
+		return nil, nil, fmt.Errorf("error reloading .env files, error: %w", err)
+	}
+	next, err := LoadConfig(current.loadOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := utils.DiffFields(current, next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &ReloadResult{}
+	keys := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.Reloadable {
+			result.Applied = append(result.Applied, change)
+			keys = append(keys, change.Key)
+		} else {
+			result.Rejected = append(result.Rejected, change)
+		}
+	}
+	if len(result.Applied) == 0 {
+		return current, result, nil
+	}
+
+	updated := *current
+	if err := utils.CopyFields(&updated, next, keys...); err != nil {
+		return nil, nil, err
+	}
+	updated.sources = maps.Clone(current.sources)
+	for _, key := range keys {
+		if source, ok := next.sources[key]; ok {
+			updated.sources[key] = source
+		} else {
+			delete(updated.sources, key)
+		}
+	}
+
+	configLock.Lock()
+	for name, registered := range configsSingletonMapping {
+		if registered == current {
+			configsSingletonMapping[name] = &updated
+		}
+	}
+	configLock.Unlock()
+
+	for _, hook := range reloadHooks {
+		if hook.origin == nil || hook.origin == updated.origin {
+			hook.hook(&updated)
+		}
+	}
+	return &updated, result, nil
+}
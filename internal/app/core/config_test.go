@@ -0,0 +1,258 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
+	"github.com/Koubae/GoAnyBusiness/pkg/utils"
+)
+
+func TestLoadConfig(t *testing.T) {
+	setEnv := func(t *testing.T, env map[string]string) {
+		for key, value := range env {
+			original, ok := os.LookupEnv(key)
+			if err := os.Setenv(key, value); err != nil {
+				t.Fatalf("setenv %s: %v", key, err)
+			}
+			t.Cleanup(
+				func() {
+					if ok {
+						_ = os.Setenv(key, original)
+					} else {
+						_ = os.Unsetenv(key)
+					}
+				},
+			)
+		}
+	}
+
+	t.Run(
+		"valid config", func(t *testing.T) {
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			if config.Env != Testing {
+				t.Errorf("Env = %v, want %v", config.Env, Testing)
+			}
+			if config.GetAddr() != ":18000" {
+				t.Errorf("GetAddr() = %v, want %v", config.GetAddr(), ":18000")
+			}
+		},
+	)
+
+	t.Run(
+		"every problem is reported", func(t *testing.T) {
+			setEnv(
+				t, map[string]string{
+					"APP_PORT":               "not_a_port",
+					"APP_ENVIRONMENT":        "prod",
+					"APP_LOG_LEVEL":          "loud",
+					"APP_NETWORKING_PROXIES": "127.0.0.1,10.0.0.0/8,not_an_ip",
+				},
+			)
+
+			_, err := LoadConfig()
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("LoadConfig() error = %v, want *ConfigError", err)
+			}
+			if len(configErr.Problems) != 4 {
+				t.Errorf("LoadConfig() reported %d problems, want 4: %v", len(configErr.Problems), err)
+			}
+		},
+	)
+
+	t.Run(
+		"shutdown timeout must be positive", func(t *testing.T) {
+			setEnv(t, map[string]string{"APP_SERVER_SHUTDOWN_TIMEOUT": "0s"})
+
+			_, err := LoadConfig()
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || !hasProblemForKey(configErr.Problems, "APP_SERVER_SHUTDOWN_TIMEOUT") {
+				t.Errorf("LoadConfig() error = %v, want a problem for APP_SERVER_SHUTDOWN_TIMEOUT", err)
+			}
+		},
+	)
+
+	t.Run(
+		"entries show sources and redact secrets", func(t *testing.T) {
+			setEnv(t, map[string]string{"APP_ADMIN_TOKEN": "s3cr3t"})
+
+			config, err := LoadConfig(WithArgs([]string{"--app-log-level=debug"}))
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+
+			want := map[string]ConfigEntry{
+				"APP_PORT":             {Key: "APP_PORT", Path: "port", Value: uint16(18000), Source: utils.SourceEnv},
+				"APP_LOG_LEVEL":        {Key: "APP_LOG_LEVEL", Path: "log_level", Value: "debug", Source: utils.SourceFlag},
+				"APP_RATE_LIMIT_BURST": {Key: "APP_RATE_LIMIT_BURST", Path: "rate_limit_burst", Value: 20, Source: utils.SourceDefault},
+				"APP_ADMIN_TOKEN":      {Key: "APP_ADMIN_TOKEN", Path: "admin_token", Value: utils.Redacted, Source: utils.SourceEnv, Secret: true},
+			}
+			for _, entry := range config.Entries() {
+				if wantEntry, ok := want[entry.Key]; ok && !reflect.DeepEqual(entry, wantEntry) {
+					t.Errorf("Entries() %s = %+v, want %+v", entry.Key, entry, wantEntry)
+				}
+			}
+			if strings.Contains(config.String(), "s3cr3t") {
+				t.Errorf("String() leaks the admin token: %s", config.String())
+			}
+		},
+	)
+
+	t.Run(
+		"server defaults per environment", func(t *testing.T) {
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			if config.Server.ShutdownTimeout != time.Second {
+				t.Errorf("Server.ShutdownTimeout = %v, want the testing default %v", config.Server.ShutdownTimeout, time.Second)
+			}
+			if config.Server.MaxBodySize != 8*utils.MiB {
+				t.Errorf("Server.MaxBodySize = %v, want %v", config.Server.MaxBodySize, 8*utils.MiB)
+			}
+
+			setEnv(t, map[string]string{"APP_SERVER_SHUTDOWN_TIMEOUT": "30s", "APP_SERVER_MAX_BODY_SIZE": "64MiB"})
+			config, err = LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() unexpected error: %v", err)
+			}
+			if config.Server.ShutdownTimeout != 30*time.Second {
+				t.Errorf("Server.ShutdownTimeout = %v, want %v from env", config.Server.ShutdownTimeout, 30*time.Second)
+			}
+			if config.Server.MaxBodySize != 64*utils.MiB {
+				t.Errorf("Server.MaxBodySize = %v, want %v from env", config.Server.MaxBodySize, 64*utils.MiB)
+			}
+		},
+	)
+
+	t.Run(
+		"log levels map in the config file", func(t *testing.T) {
+			want := map[string]string{"orders": "debug", "http.client": "warn"}
+			tests := []struct {
+				name     string
+				fileName string
+				content  string
+			}{
+				{"yaml", "config.yaml", "log_levels:\n  orders: debug\n  http.client: warn\n"},
+				{"toml", "config.toml", "[log_levels]\norders = \"debug\"\n\"http.client\" = \"warn\"\n"},
+				{"json", "config.json", `{"log_levels": {"orders": "debug", "http.client": "warn"}}`},
+				{"string", "config.yaml", "log_levels: orders=debug,http.client=warn\n"},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						path := filepath.Join(t.TempDir(), tt.fileName)
+						if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+							t.Fatalf("WriteFile() unexpected error: %v", err)
+						}
+
+						config, err := LoadConfig(WithConfigFile(path))
+						if err != nil {
+							t.Fatalf("LoadConfig() unexpected error: %v", err)
+						}
+						if !reflect.DeepEqual(config.AppLogLevels, want) {
+							t.Errorf("AppLogLevels = %v, want %v", config.AppLogLevels, want)
+						}
+					},
+				)
+			}
+		},
+	)
+}
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		applied  []string
+		rejected []string
+		wantErr  bool
+	}{
+		{"nothing changed", nil, nil, nil, false},
+		{"reloadable changes are applied", map[string]string{"APP_LOG_LEVEL": "debug", "APP_MAINTENANCE_MODE": "true"}, []string{"APP_LOG_LEVEL", "APP_MAINTENANCE_MODE"}, nil, false},
+		{"restart only change is rejected", map[string]string{"APP_PORT": "18001"}, nil, []string{"APP_PORT"}, false},
+		{"applied and rejected changes", map[string]string{"APP_PORT": "18001", "APP_MAINTENANCE_MODE": "true"}, []string{"APP_MAINTENANCE_MODE"}, []string{"APP_PORT"}, false},
+		{"invalid value aborts the reload", map[string]string{"APP_MAINTENANCE_MODE": "true", "APP_LOG_LEVEL": "loud"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Setenv("PORT", "") // Set by RegisterConfig
+				config, err := LoadConfig()
+				if err != nil {
+					t.Fatalf("LoadConfig() unexpected error: %v", err)
+				}
+				configName := "reload " + tt.name
+				if err := RegisterConfig(configName, config); err != nil {
+					t.Fatalf("RegisterConfig() unexpected error: %v", err)
+				}
+				var reloaded []*Config
+				removeHook := OnConfigReloadOf(config, func(updated *Config) { reloaded = append(reloaded, updated) })
+				t.Cleanup(removeHook)
+
+				for key, value := range tt.env {
+					t.Setenv(key, value)
+				}
+				result, err := ReloadConfig(configName)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ReloadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					var configErr *ConfigError
+					if !errors.As(err, &configErr) || !hasProblemForKey(configErr.Problems, "APP_LOG_LEVEL") {
+						t.Errorf("ReloadConfig() error = %v, want a problem for APP_LOG_LEVEL", err)
+					}
+				} else {
+					if got := changeKeys(result.Applied); !reflect.DeepEqual(got, tt.applied) {
+						t.Errorf("ReloadConfig() applied = %v, want %v", got, tt.applied)
+					}
+					if got := changeKeys(result.Rejected); !reflect.DeepEqual(got, tt.rejected) {
+						t.Errorf("ReloadConfig() rejected = %v, want %v", got, tt.rejected)
+					}
+				}
+
+				current := GetConfig(configName)
+				if len(tt.applied) == 0 {
+					if current != config {
+						t.Errorf("GetConfig() = %p, want the config loaded first %p", current, config)
+					}
+					if len(reloaded) != 0 {
+						t.Errorf("reload hook called %d times, want none", len(reloaded))
+					}
+					return
+				}
+				if len(reloaded) != 1 || reloaded[0] != current {
+					t.Fatalf("reload hook called with %v, want once with the registered config %p", reloaded, current)
+				}
+				if !current.MaintenanceMode {
+					t.Errorf("MaintenanceMode = %v, want true", current.MaintenanceMode)
+				}
+				if current.Port != config.Port {
+					t.Errorf("Port = %v, want it kept at %v until a restart", current.Port, config.Port)
+				}
+				if config.MaintenanceMode {
+					t.Errorf("MaintenanceMode of the config loaded first = %v, want it unchanged", config.MaintenanceMode)
+				}
+			},
+		)
+	}
+}
+
+func changeKeys(changes []utils.FieldChange) []string {
+	var keys []string
+	for _, change := range changes {
+		keys = append(keys, change.Key)
+	}
+	return keys
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	// DotEnvFile is the base of the .env cascade, see DotEnvCascade
+	DotEnvFile = ".env"
+	// EnvironmentEnvKey is the env var selecting the environment, and so the .env cascade
+	EnvironmentEnvKey = "APP_ENVIRONMENT"
+)
+
+var (
+	dotEnvLock     sync.Mutex
+	dotEnvFiles    []string
+	dotEnvOptional bool
+	// Keys set by the real environment before any .env file was loaded, these are never overridden
+	realEnvKeys map[string]bool
+	// Keys currently set from .env files, so keys removed from the files can be unset on reload
+	dotEnvKeys = make(map[string]bool)
+)
+
+// DotEnvCascade returns the .env files for the environment, from lowest to highest precedence:
+// .env, .env.<environment>, .env.local and .env.<environment>.local
+func DotEnvCascade(environment Environment) []string {
+	return []string{
+		DotEnvFile,
+		DotEnvFile + "." + string(environment),
+		DotEnvFile + ".local",
+		DotEnvFile + "." + string(environment) + ".local",
+	}
+}
+
+// LoadDotEnvCascade loads the DotEnvCascade of the environment set by APP_ENVIRONMENT, read from
+// the real environment, .env.local or .env in this order. Every file is optional.
+// It returns the files that were found and loaded.
+func LoadDotEnvCascade() ([]string, error) {
+	dotEnvLock.Lock()
+	defer dotEnvLock.Unlock()
+
+	dotEnvFiles = DotEnvCascade(detectEnvironment())
+	dotEnvOptional = true
+	return loadDotEnvFiles()
+}
+
+// LoadDotEnv loads the given .env files, which must exist.
+// It returns the files that were loaded.
+func LoadDotEnv(files ...string) ([]string, error) {
+	dotEnvLock.Lock()
+	defer dotEnvLock.Unlock()
+
+	dotEnvFiles = files
+	dotEnvOptional = false
+	return loadDotEnvFiles()
+}
+
+// ReloadDotEnv re-reads the .env files given to LoadDotEnv or LoadDotEnvCascade
+func ReloadDotEnv() ([]string, error) {
+	dotEnvLock.Lock()
+	defer dotEnvLock.Unlock()
+
+	return loadDotEnvFiles()
+}
+
+// DotEnvKeys returns the variables currently set from .env files, sorted. Child processes re-reading the
+// files must not inherit them, or they would take them for the real environment.
+func DotEnvKeys() []string {
+	dotEnvLock.Lock()
+	defer dotEnvLock.Unlock()
+
+	return slices.Sorted(maps.Keys(dotEnvKeys))
+}
+
+// loadDotEnvFiles sets the values of the .env files without overriding variables set in the real
+// environment, later files take precedence over earlier ones
+func loadDotEnvFiles() ([]string, error) {
+	if realEnvKeys == nil {
+		realEnvKeys = make(map[string]bool)
+		for _, key := range envKeys() {
+			realEnvKeys[key] = true
+		}
+	}
+
+	files := dotEnvFiles
+	if dotEnvOptional {
+		files = existingFiles(files)
+	}
+	values := make(map[string]string)
+	if len(files) > 0 {
+		var err error
+		if values, err = godotenv.Read(files...); err != nil {
+			return nil, err
+		}
+	}
+
+	for key := range dotEnvKeys {
+		if _, ok := values[key]; !ok {
+			_ = os.Unsetenv(key)
+			delete(dotEnvKeys, key)
+		}
+	}
+	for key, value := range values {
+		if realEnvKeys[key] {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return nil, err
+		}
+		dotEnvKeys[key] = true
+	}
+	return files, nil
+}
+
+func detectEnvironment() Environment {
+	if environment, ok := os.LookupEnv(EnvironmentEnvKey); ok && strings.TrimSpace(environment) != "" {
+		return Environment(strings.TrimSpace(environment))
+	}
+	for _, file := range existingFiles([]string{DotEnvFile + ".local", DotEnvFile}) {
+		values, err := godotenv.Read(file)
+		if err != nil {
+			continue
+		}
+		if environment := strings.TrimSpace(values[EnvironmentEnvKey]); environment != "" {
+			return Environment(environment)
+		}
+	}
+	return Development
+}
+
+func existingFiles(files []string) []string {
+	existing := make([]string, 0, len(files))
+	for _, file := range files {
+		if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+func envKeys() []string {
+	environ := os.Environ()
+	keys := make([]string, 0, len(environ))
+	for _, entry := range environ {
+		key, _, _ := strings.Cut(entry, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
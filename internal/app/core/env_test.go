@@ -0,0 +1,87 @@
+package core
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
+)
+
+func TestLoadDotEnvCascade(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) {
+		dir := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+				t.Fatalf("write %s: %v", name, err)
+			}
+		}
+		t.Chdir(dir)
+	}
+	// cleanup unsets the keys loaded from the files and restores the keys tracked by LoadDotEnvCascade
+	cleanup := func(t *testing.T, keys ...string) {
+		savedRealEnvKeys, savedDotEnvKeys := realEnvKeys, maps.Clone(dotEnvKeys)
+		t.Cleanup(
+			func() {
+				for _, key := range keys {
+					_ = os.Unsetenv(key)
+				}
+				realEnvKeys, dotEnvKeys = savedRealEnvKeys, savedDotEnvKeys
+			},
+		)
+	}
+
+	t.Run(
+		"later files override earlier ones and missing files are skipped", func(t *testing.T) {
+			// APP_ENVIRONMENT=testing comes from tests/.env.test
+			writeFiles(
+				t, map[string]string{
+					".env":               "CASCADE_A=env\nCASCADE_B=env\nCASCADE_REAL=env\n",
+					".env.testing":       "CASCADE_B=testing\nCASCADE_C=testing\n",
+					".env.testing.local": "CASCADE_C=local\n",
+				},
+			)
+			cleanup(t, "CASCADE_A", "CASCADE_B", "CASCADE_C")
+			t.Setenv("CASCADE_REAL", "real")
+			realEnvKeys = nil // Snapshot the real environment again, with CASCADE_REAL
+
+			files, err := LoadDotEnvCascade()
+			if err != nil {
+				t.Fatalf("LoadDotEnvCascade() unexpected error: %v", err)
+			}
+			want := []string{".env", ".env.testing", ".env.testing.local"}
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("LoadDotEnvCascade() files = %v, want %v", files, want)
+			}
+
+			expected := map[string]string{
+				"CASCADE_A":    "env",
+				"CASCADE_B":    "testing",
+				"CASCADE_C":    "local",
+				"CASCADE_REAL": "real",
+			}
+			for key, value := range expected {
+				if got := os.Getenv(key); got != value {
+					t.Errorf("%s = %v, want %v", key, got, value)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"no files", func(t *testing.T) {
+			writeFiles(t, nil)
+			cleanup(t)
+
+			files, err := LoadDotEnvCascade()
+			if err != nil {
+				t.Fatalf("LoadDotEnvCascade() unexpected error: %v", err)
+			}
+			if len(files) != 0 {
+				t.Errorf("LoadDotEnvCascade() files = %v, want none", files)
+			}
+		},
+	)
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHealthCheckTimeout bounds a HealthCheck that sets no Timeout
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthStatus is the status of a check or of the whole report
+type HealthStatus string
+
+// Health statuses, a report is degraded when only non-critical checks are down
+const (
+	HealthUp       HealthStatus = "up"
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+)
+
+var defaultHealthChecker = NewHealthChecker()
+
+// HealthCheck is a named readiness check of a dependency, like a database or a downstream API
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Critical checks make the app not ready when failing, non-critical ones are only reported
+	Critical bool
+	// Timeout bounds each run of Check, DefaultHealthCheckTimeout when 0
+	Timeout time.Duration
+	// CacheTTL reuses the last result for this long so frequent probes don't hammer the dependency, 0 disables it
+	CacheTTL time.Duration
+}
+
+// HealthCheckResult is the outcome of the last run of a check
+type HealthCheckResult struct {
+	Name      string       `json:"name"`
+	Status    HealthStatus `json:"status"`
+	Critical  bool         `json:"critical"`
+	LatencyMs float64      `json:"latency_ms"`
+	CheckedAt time.Time    `json:"checked_at"`
+	// LastError is the error of the last failed run, kept once the check recovers to spot flapping
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// HealthReport is the result of every check, Status is down when a critical check is down or
+// when draining
+type HealthReport struct {
+	Status   HealthStatus        `json:"status"`
+	Draining bool                `json:"draining,omitempty"`
+	Checks   []HealthCheckResult `json:"checks"`
+}
+
+// HealthChecker is a registry of health checks
+type HealthChecker struct {
+	lock     sync.Mutex
+	checks   []*registeredHealthCheck
+	draining atomic.Bool
+}
+
+type registeredHealthCheck struct {
+	HealthCheck
+	lock      sync.Mutex
+	result    HealthCheckResult
+	expiresAt time.Time
+}
+
+// NewHealthChecker creates an empty registry, see GetHealthChecker for the one served by /ready
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{}
+}
+
+// GetHealthChecker returns the registry of the checks served by /ready
+func GetHealthChecker() *HealthChecker {
+	return defaultHealthChecker
+}
+
+// RegisterHealthCheck registers a check served by /ready
+func RegisterHealthCheck(check HealthCheck) error {
+	return defaultHealthChecker.Register(check)
+}
+
+// Register adds a check, names must be unique
+func (h *HealthChecker) Register(check HealthCheck) error {
+	if check.Name == "" || check.Check == nil {
+		return errors.New("health check must have a name and a check function")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, registered := range h.checks {
+		if registered.Name == check.Name {
+			return fmt.Errorf("health check '%s' already exists", check.Name)
+		}
+	}
+	h.checks = append(h.checks, &registeredHealthCheck{HealthCheck: check})
+	return nil
+}
+
+// Unregister removes the named check, if registered
+func (h *HealthChecker) Unregister(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, registered := range h.checks {
+		if registered.Name == name {
+			h.checks = append(h.checks[:i], h.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetDraining marks the app as shutting down, the reports are down while draining so load
+// balancers stop routing new traffic
+func (h *HealthChecker) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+// Check runs every check concurrently, each bounded by its timeout, and reports their results
+// in registration order
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	h.lock.Lock()
+	checks := append([]*registeredHealthCheck(nil), h.checks...)
+	h.lock.Unlock()
+
+	report := HealthReport{Status: HealthUp, Checks: make([]HealthCheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = check.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		report.Status = HealthDown
+		report.Draining = true
+		return report
+	}
+	for _, result := range report.Checks {
+		if result.Status == HealthUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// run returns the cached result while fresh, otherwise runs the check, returning once the
+// timeout expires even if the check ignores ctx. The check runs on its own timeout rather than
+// ctx, a probe giving up first gets a down result which is not cached.
+func (c *registeredHealthCheck) run(ctx context.Context) HealthCheckResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expiresAt) {
+		return c.result
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	case <-ctx.Done():
+		return HealthCheckResult{
+			Name:      c.Name,
+			Status:    HealthDown,
+			Critical:  c.Critical,
+			LatencyMs: float64(time.Since(now).Microseconds()) / 1000,
+			CheckedAt: now.UTC(),
+			LastError: fmt.Sprintf("probe gave up: %s", ctx.Err()),
+		}
+	}
+
+	c.result.Name = c.Name
+	c.result.Critical = c.Critical
+	c.result.Status = HealthUp
+	c.result.LatencyMs = float64(time.Since(now).Microseconds()) / 1000
+	c.result.CheckedAt = now.UTC()
+	if err != nil {
+		c.result.Status = HealthDown
+		c.result.LastError = err.Error()
+		checkedAt := c.result.CheckedAt
+		c.result.LastErrorAt = &checkedAt
+	}
+	c.expiresAt = now.Add(c.CacheTTL)
+	return c.result
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name   string
+		checks []HealthCheck
+		status HealthStatus
+	}{
+		{"no checks", nil, HealthUp},
+		{"all up", []HealthCheck{{Name: "db", Check: up, Critical: true}, {Name: "cache", Check: up}}, HealthUp},
+		{"non-critical down", []HealthCheck{{Name: "db", Check: up, Critical: true}, {Name: "cache", Check: down}}, HealthDegraded},
+		{"critical down", []HealthCheck{{Name: "db", Check: down, Critical: true}, {Name: "cache", Check: up}}, HealthDown},
+		{
+			"timeout", []HealthCheck{
+				{
+					Name: "slow", Critical: true, Timeout: 10 * time.Millisecond, Check: func(context.Context) error {
+						time.Sleep(time.Second) // Ignores the context
+						return nil
+					},
+				},
+			}, HealthDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				checker := NewHealthChecker()
+				for _, check := range tt.checks {
+					if err := checker.Register(check); err != nil {
+						t.Fatalf("Register() unexpected error: %v", err)
+					}
+				}
+
+				report := checker.Check(context.Background())
+				if report.Status != tt.status {
+					t.Errorf("Check() status = %v, want %v: %+v", report.Status, tt.status, report.Checks)
+				}
+				if len(report.Checks) != len(tt.checks) {
+					t.Fatalf("Check() returned %d results, want %d", len(report.Checks), len(tt.checks))
+				}
+				for i, result := range report.Checks {
+					if result.Name != tt.checks[i].Name {
+						t.Errorf("Check() result %d = %v, want %v", i, result.Name, tt.checks[i].Name)
+					}
+					if (result.Status == HealthDown) != (result.LastError != "") {
+						t.Errorf("Check() result %s status %v with last error %q", result.Name, result.Status, result.LastError)
+					}
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"cached results keep the last error", func(t *testing.T) {
+			calls := 0
+			checker := NewHealthChecker()
+			err := checker.Register(
+				HealthCheck{
+					Name: "db", Critical: true, CacheTTL: time.Hour, Check: func(context.Context) error {
+						calls++
+						return errors.New("connection refused")
+					},
+				},
+			)
+			if err != nil {
+				t.Fatalf("Register() unexpected error: %v", err)
+			}
+			if err := checker.Register(HealthCheck{Name: "db", Check: up}); err == nil {
+				t.Errorf("Register() duplicate name, want an error")
+			}
+
+			checker.Check(context.Background())
+			report := checker.Check(context.Background())
+			if calls != 1 {
+				t.Errorf("check ran %d times, want 1", calls)
+			}
+			if report.Checks[0].LastError != "connection refused" {
+				t.Errorf("LastError = %q, want %q", report.Checks[0].LastError, "connection refused")
+			}
+		},
+	)
+
+	t.Run(
+		"cancelled probes are not cached", func(t *testing.T) {
+			checker := NewHealthChecker()
+			err := checker.Register(
+				HealthCheck{
+					Name: "db", Critical: true, CacheTTL: time.Hour, Check: func(context.Context) error {
+						time.Sleep(10 * time.Millisecond)
+						return nil
+					},
+				},
+			)
+			if err != nil {
+				t.Fatalf("Register() unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if report := checker.Check(ctx); report.Status != HealthDown {
+				t.Errorf("Check() of a cancelled probe status = %v, want %v", report.Status, HealthDown)
+			}
+			if report := checker.Check(context.Background()); report.Status != HealthUp {
+				t.Errorf("Check() after a cancelled probe status = %v, want %v: %+v", report.Status, HealthUp, report.Checks)
+			}
+		},
+	)
+}
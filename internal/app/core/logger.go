@@ -1,8 +1,12 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
@@ -11,37 +15,287 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-const DefaultLoggerName = "default"
+const (
+	DefaultLoggerName = "default"
+	// HTTPLoggerName is the named logger of the access log
+	HTTPLoggerName = "http"
+)
+
+// ErrUnknownLogger is returned for names no logger is registered under
+var ErrUnknownLogger = errors.New("unknown logger")
+
+var (
+	loggersLock     sync.RWMutex
+	loggerSingleton = make(map[string]*zap.SugaredLogger)
+	loggerLevels    = make(map[string]*loggerLevel)
+	// rootLogger is the parent of every logger, NamedLogger derives from it
+	rootLogger       *zap.Logger
+	configuredLevels = map[string]zapcore.Level{DefaultLoggerName: zapcore.InfoLevel}
+)
+
+// loggerLevel is the level of a registered logger, along with the pending revert of a temporary change
+type loggerLevel struct {
+	level      zap.AtomicLevel
+	configured zapcore.Level
+	revert     *time.Timer
+	revertsAt  time.Time
+}
+
+// afterFunc schedules the revert of temporary log levels, replaced in tests
+var afterFunc = time.AfterFunc
 
-var loggerSingleton = make(map[string]*zap.SugaredLogger)
+// LogLevel is the current level of a logger, Configured is the one it reverts to after a temporary change
+type LogLevel struct {
+	Logger     string     `json:"logger"`
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	RevertsAt  *time.Time `json:"reverts_at,omitempty"`
+}
 
-// CreateLogger creates a new logger
-func CreateLogger(config *Config) (*zap.Logger, *gin.HandlerFunc, error) {
+// CreateLogger creates the default logger, along with the request logging middleware which logs to the
+// "http" named logger. Every logger derives from the same root, which lets every level through and leaves
+// filtering to the level of each logger. opts are applied to the root, after the defaults.
+func CreateLogger(config *Config, opts ...zap.Option) (*zap.Logger, *gin.HandlerFunc, error) {
 	var cnf *zap.Config
-	level := parseLogLevel(config.AppLogLevel)
+	level, _ := parseLogLevel(config.AppLogLevel)
 
 	switch config.Env {
 	case Testing, Development:
-		cnf = newDevelopmentConfig(level)
+		cnf = newDevelopmentConfig(zapcore.DebugLevel)
 	default:
-		cnf = newProductionConfig(level)
+		cnf = newProductionConfig(zapcore.DebugLevel)
 	}
 
-	logger, err := cnf.Build(zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
+	root, err := cnf.Build(append([]zap.Option{zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel)}, opts...)...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("build logger error: %w", err)
 	}
+	defaultLevel := zap.NewAtomicLevelAt(level)
+	logger := root.WithOptions(zap.IncreaseLevel(defaultLevel))
+
+	// Named loggers of a previous root are created again from this one on next use
+	loggersLock.Lock()
+	for _, state := range loggerLevels {
+		if state.revert != nil {
+			state.revert.Stop()
+		}
+	}
+	clear(loggerSingleton)
+	clear(loggerLevels)
+	rootLogger = root
+	configuredLevels = logLevelsOf(config)
+	loggersLock.Unlock()
+	registerLogger(DefaultLoggerName, logger.Sugar(), defaultLevel)
 
 	middleware := ginzap.GinzapWithConfig(
-		logger,
-		&ginzap.Config{TimeFormat: time.RFC3339, UTC: true, DefaultLevel: zapcore.InfoLevel},
+		NamedLogger(HTTPLoggerName).Desugar(),
+		&ginzap.Config{
+			TimeFormat:   time.RFC3339,
+			UTC:          true,
+			DefaultLevel: zapcore.InfoLevel,
+			Context: func(c *gin.Context) []zapcore.Field {
+				return RequestIDFields(c.Request.Context())
+			},
+		},
 	)
-	loggerSingleton[DefaultLoggerName] = logger.Sugar()
 	return logger, &middleware, nil
 }
 
+// NamedLogger returns the logger of a subsystem, created on first use as a child of the default logger
+// with its own level: the one of APP_LOG_LEVELS for name, APP_LOG_LEVEL otherwise. Its level can be
+// changed on its own at runtime, see SetLogLevel. Before CreateLogger it returns a no-op logger.
+func NamedLogger(name string) *zap.SugaredLogger {
+	loggersLock.RLock()
+	logger, ok := loggerSingleton[name]
+	root := rootLogger
+	loggersLock.RUnlock()
+	if ok {
+		return logger
+	}
+	if root == nil {
+		return zap.NewNop().Sugar()
+	}
+
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	if logger, ok := loggerSingleton[name]; ok {
+		return logger // Created concurrently
+	}
+	level := zap.NewAtomicLevelAt(configuredLevel(name))
+	logger = root.Named(name).WithOptions(zap.IncreaseLevel(level)).Sugar()
+	loggerSingleton[name] = logger
+	loggerLevels[name] = &loggerLevel{level: level, configured: level.Level()}
+	return logger
+}
+
+// ApplyLogLevels sets the level of every logger from APP_LOG_LEVEL and APP_LOG_LEVELS, on config reload.
+// A temporary level stays on, the new one applies once it reverts.
+func ApplyLogLevels(config *Config) error {
+	loggersLock.Lock()
+	configuredLevels = logLevelsOf(config)
+	levels := make(map[string]zapcore.Level, len(loggerLevels))
+	for name := range loggerLevels {
+		levels[name] = configuredLevel(name)
+	}
+	loggersLock.Unlock()
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(levels)) {
+		if err := setConfiguredLogLevel(name, levels[name], false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logLevelsOf returns the level of every logger configured by config, the default one under DefaultLoggerName
+func logLevelsOf(config *Config) map[string]zapcore.Level {
+	levels := make(map[string]zapcore.Level, len(config.AppLogLevels)+1)
+	levels[DefaultLoggerName], _ = parseLogLevel(config.AppLogLevel)
+	for name, level := range config.AppLogLevels {
+		if parsed, ok := parseLogLevel(level); ok {
+			levels[name] = parsed
+		}
+	}
+	return levels
+}
+
+// configuredLevel returns the configured level of the named logger, must be called with loggersLock held
+func configuredLevel(name string) zapcore.Level {
+	if level, ok := configuredLevels[name]; ok {
+		return level
+	}
+	return configuredLevels[DefaultLoggerName]
+}
+
+func registerLogger(name string, logger *zap.SugaredLogger, level zap.AtomicLevel) {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	if previous, ok := loggerLevels[name]; ok && previous.revert != nil {
+		previous.revert.Stop()
+	}
+	loggerSingleton[name] = logger
+	loggerLevels[name] = &loggerLevel{level: level, configured: level.Level()}
+}
+
+// SetLogLevel changes the level of a logger at runtime, cancelling the revert of a temporary level
+func SetLogLevel(name, level string) error {
+	parsed, ok := parseLogLevel(level)
+	if !ok {
+		return fmt.Errorf("unknown log level '%s'", level)
+	}
+	return setConfiguredLogLevel(name, parsed, true)
+}
+
+// setConfiguredLogLevel sets the level a logger reverts to, applied right away unless a temporary level is
+// on and override is false
+func setConfiguredLogLevel(name string, level zapcore.Level, override bool) error {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	state, ok := loggerLevels[name]
+	if !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownLogger, name)
+	}
+	state.configured = level
+	if state.revert != nil && override {
+		state.revert.Stop()
+		state.revert = nil
+	}
+	if state.revert == nil {
+		state.level.SetLevel(level)
+	}
+	return nil
+}
+
+// SetTemporaryLogLevel changes the level of a logger for duration, it then reverts to the configured level,
+// the one of the config or of SetLogLevel. A duration of 0 changes it for good, as SetLogLevel does.
+func SetTemporaryLogLevel(name, level string, duration time.Duration) error {
+	if duration <= 0 {
+		return SetLogLevel(name, level)
+	}
+	parsed, ok := parseLogLevel(level)
+	if !ok {
+		return fmt.Errorf("unknown log level '%s'", level)
+	}
+
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	state, ok := loggerLevels[name]
+	if !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownLogger, name)
+	}
+	if state.revert != nil {
+		state.revert.Stop()
+	}
+	state.level.SetLevel(parsed)
+	state.revertsAt = time.Now().Add(duration)
+	var revert *time.Timer
+	revert = afterFunc(
+		duration, func() {
+			loggersLock.Lock()
+			defer loggersLock.Unlock()
+
+			if state.revert != revert {
+				return // Replaced by a later change
+			}
+			state.level.SetLevel(state.configured)
+			state.revert = nil
+		},
+	)
+	state.revert = revert
+	return nil
+}
+
+// GetLogLevel returns the level of a logger
+func GetLogLevel(name string) (LogLevel, error) {
+	loggersLock.RLock()
+	defer loggersLock.RUnlock()
+
+	state, ok := loggerLevels[name]
+	if !ok {
+		return LogLevel{}, fmt.Errorf("%w '%s'", ErrUnknownLogger, name)
+	}
+	return state.describe(name), nil
+}
+
+// GetLogLevels returns the level of every logger, sorted by name
+func GetLogLevels() []LogLevel {
+	loggersLock.RLock()
+	defer loggersLock.RUnlock()
+
+	levels := make([]LogLevel, 0, len(loggerLevels))
+	for _, name := range slices.Sorted(maps.Keys(loggerLevels)) {
+		levels = append(levels, loggerLevels[name].describe(name))
+	}
+	return levels
+}
+
+// LoggerNames returns the names of the registered loggers, sorted
+func LoggerNames() []string {
+	loggersLock.RLock()
+	defer loggersLock.RUnlock()
+
+	return slices.Sorted(maps.Keys(loggerLevels))
+}
+
+func (l *loggerLevel) describe(name string) LogLevel {
+	level := LogLevel{Logger: name, Level: l.level.Level().String(), Configured: l.configured.String()}
+	if l.revert != nil {
+		revertsAt := l.revertsAt
+		level.RevertsAt = &revertsAt
+	}
+	return level
+}
+
 // GetLogger returns a logger by name
 func GetLogger(name string) *zap.SugaredLogger {
+	loggersLock.RLock()
+	defer loggersLock.RUnlock()
+
 	logger, ok := loggerSingleton[name]
 	if !ok {
 		panic(fmt.Sprintf("Logger '%s' does not exist", name))
@@ -107,23 +361,23 @@ func newDevelopmentConfig(level zapcore.Level) *zap.Config {
 	}
 }
 
-func parseLogLevel(s string) zapcore.Level {
+func parseLogLevel(s string) (zapcore.Level, bool) {
 	switch strings.ToUpper(strings.TrimSpace(s)) {
 	case "DEBUG":
-		return zapcore.DebugLevel
+		return zapcore.DebugLevel, true
 	case "INFO":
-		return zapcore.InfoLevel
+		return zapcore.InfoLevel, true
 	case "WARN", "WARNING":
-		return zapcore.WarnLevel
+		return zapcore.WarnLevel, true
 	case "ERROR":
-		return zapcore.ErrorLevel
+		return zapcore.ErrorLevel, true
 	case "DPANIC":
-		return zapcore.DPanicLevel
+		return zapcore.DPanicLevel, true
 	case "PANIC":
-		return zapcore.PanicLevel
+		return zapcore.PanicLevel, true
 	case "FATAL":
-		return zapcore.FatalLevel
+		return zapcore.FatalLevel, true
 	default:
-		return zapcore.InfoLevel
+		return zapcore.InfoLevel, false
 	}
 }
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type loggerContextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger, see LoggerFrom
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// WithLogFields returns a copy of ctx whose logger adds the given key-value pairs to every line,
+// e.g. WithLogFields(ctx, "user_id", user.ID, "tenant", user.Tenant)
+func WithLogFields(ctx context.Context, keysAndValues ...any) context.Context {
+	return WithLogger(ctx, LoggerFrom(ctx).With(keysAndValues...))
+}
+
+// LoggerFrom returns the logger of ctx, within a request it carries the request ID and route along with
+// the fields added by WithLogFields. Outside of one it is the default logger.
+func LoggerFrom(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	loggersLock.RLock()
+	defer loggersLock.RUnlock()
+
+	if logger, ok := loggerSingleton[DefaultLoggerName]; ok {
+		return logger
+	}
+	return zap.S() // No-op until a logger is created, e.g. in tests
+}
+
+// GinLogger returns the logger of the request of c, see LoggerFrom
+func GinLogger(c *gin.Context) *zap.SugaredLogger {
+	return LoggerFrom(c.Request.Context())
+}
+
+// AddGinLogFields adds the given key-value pairs to the logger of the request of c, for the
+// middlewares and handlers running after, see WithLogFields
+func AddGinLogFields(c *gin.Context, keysAndValues ...any) {
+	c.Request = c.Request.WithContext(WithLogFields(c.Request.Context(), keysAndValues...))
+}
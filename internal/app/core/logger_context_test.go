@@ -0,0 +1,40 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerFrom(t *testing.T) {
+	t.Run(
+		"outside a request", func(t *testing.T) {
+			if LoggerFrom(context.Background()) == nil {
+				t.Errorf("LoggerFrom() = nil, want the default logger")
+			}
+		},
+	)
+
+	t.Run(
+		"fields added down the context", func(t *testing.T) {
+			observed, logs := observer.New(zap.InfoLevel)
+			ctx := WithLogger(context.Background(), zap.New(observed).Sugar().With(RequestIDKey, "abc-123"))
+			ctx = WithLogFields(ctx, "tenant", "acme")
+
+			LoggerFrom(ctx).Infof("order %d created", 42)
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("got %d log entries, want 1", len(entries))
+			}
+			fields := entries[0].ContextMap()
+			if fields[RequestIDKey] != "abc-123" || fields["tenant"] != "acme" {
+				t.Errorf("fields = %v, want %s and tenant", fields, RequestIDKey)
+			}
+			if entries[0].Message != "order 42 created" {
+				t.Errorf("message = %q, want %q", entries[0].Message, "order 42 created")
+			}
+		},
+	)
+}
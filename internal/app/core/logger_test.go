@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	// Reverts run when the test fires them
+	var reverts []func()
+	previous := afterFunc
+	t.Cleanup(func() { afterFunc = previous })
+	afterFunc = func(_ time.Duration, revert func()) *time.Timer {
+		reverts = append(reverts, revert)
+		return time.NewTimer(time.Hour) // Only stopped
+	}
+	revert := func(t *testing.T) {
+		t.Helper()
+		if len(reverts) == 0 {
+			t.Fatalf("no revert scheduled")
+		}
+		reverts[len(reverts)-1]()
+	}
+	setTemporary := func(t *testing.T, level *zap.AtomicLevel) {
+		t.Helper()
+		if err := SetTemporaryLogLevel("levels-test", "debug", time.Minute); err != nil {
+			t.Fatalf("SetTemporaryLogLevel() unexpected error: %v", err)
+		}
+		if level.Level() != zapcore.DebugLevel {
+			t.Errorf("level = %v, want %v", level.Level(), zapcore.DebugLevel)
+		}
+		state, err := GetLogLevel("levels-test")
+		if err != nil || state.RevertsAt == nil || state.Configured != "info" {
+			t.Errorf("GetLogLevel() = %+v, %v, want a pending revert to info", state, err)
+		}
+	}
+
+	t.Run(
+		"config change applies after the revert", func(t *testing.T) {
+			level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+			registerLogger("levels-test", zap.NewNop().Sugar(), level)
+			setTemporary(t, &level)
+
+			if err := setConfiguredLogLevel("levels-test", zapcore.WarnLevel, false); err != nil {
+				t.Fatalf("setConfiguredLogLevel() unexpected error: %v", err)
+			}
+			if level.Level() != zapcore.DebugLevel {
+				t.Errorf("level = %v, want the temporary %v", level.Level(), zapcore.DebugLevel)
+			}
+			revert(t)
+			if level.Level() != zapcore.WarnLevel {
+				t.Errorf("level after revert = %v, want %v", level.Level(), zapcore.WarnLevel)
+			}
+			if state, _ := GetLogLevel("levels-test"); state.RevertsAt != nil {
+				t.Errorf("RevertsAt = %v after revert, want nil", state.RevertsAt)
+			}
+		},
+	)
+
+	t.Run(
+		"explicit change cancels the revert", func(t *testing.T) {
+			level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+			registerLogger("levels-test", zap.NewNop().Sugar(), level)
+			setTemporary(t, &level)
+
+			if err := SetLogLevel("levels-test", "warn"); err != nil {
+				t.Fatalf("SetLogLevel() unexpected error: %v", err)
+			}
+			if level.Level() != zapcore.WarnLevel {
+				t.Errorf("level = %v, want %v", level.Level(), zapcore.WarnLevel)
+			}
+			if state, _ := GetLogLevel("levels-test"); state.RevertsAt != nil {
+				t.Errorf("RevertsAt = %v after SetLogLevel(), want nil", state.RevertsAt)
+			}
+			revert(t) // Fired late, after being stopped
+			if level.Level() != zapcore.WarnLevel {
+				t.Errorf("level after a cancelled revert = %v, want %v", level.Level(), zapcore.WarnLevel)
+			}
+		},
+	)
+
+	if err := SetLogLevel("missing", "debug"); !errors.Is(err, ErrUnknownLogger) {
+		t.Errorf("SetLogLevel() of a missing logger = %v, want %v", err, ErrUnknownLogger)
+	}
+	if err := SetLogLevel("levels-test", "loud"); err == nil {
+		t.Errorf("SetLogLevel() of an unknown level, want an error")
+	}
+}
+
+func TestNamedLogger(t *testing.T) {
+	config, err := LoadConfig(WithArgs([]string{"--app-log-level=info", "--app-log-levels=orders=debug,http=warn"}))
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error: %v", err)
+	}
+	if _, _, err := CreateLogger(config); err != nil {
+		t.Fatalf("CreateLogger() unexpected error: %v", err)
+	}
+	enabled := func(name string, level zapcore.Level) bool {
+		return NamedLogger(name).Desugar().Core().Enabled(level)
+	}
+
+	tests := []struct {
+		name    string
+		logger  string
+		level   zapcore.Level
+		enabled bool
+	}{
+		{"configured lower", "orders", zapcore.DebugLevel, true},
+		{"configured higher", HTTPLoggerName, zapcore.InfoLevel, false},
+		{"default level", "payments", zapcore.InfoLevel, true},
+		{"default level filters", "payments", zapcore.DebugLevel, false},
+		{"default logger", DefaultLoggerName, zapcore.DebugLevel, false},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := enabled(tt.logger, tt.level); got != tt.enabled {
+					t.Errorf("%s enabled at %v = %v, want %v", tt.logger, tt.level, got, tt.enabled)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"levels are independent", func(t *testing.T) {
+			if err := SetLogLevel("payments", "debug"); err != nil {
+				t.Fatalf("SetLogLevel() unexpected error: %v", err)
+			}
+			if !enabled("payments", zapcore.DebugLevel) || enabled(DefaultLoggerName, zapcore.DebugLevel) {
+				t.Errorf("debug enabled on payments = %v and default = %v, want true and false",
+					enabled("payments", zapcore.DebugLevel), enabled(DefaultLoggerName, zapcore.DebugLevel))
+			}
+
+			config.AppLogLevels = map[string]string{"payments": "error"}
+			if err := ApplyLogLevels(config); err != nil {
+				t.Fatalf("ApplyLogLevels() unexpected error: %v", err)
+			}
+			if enabled("payments", zapcore.WarnLevel) || !enabled("orders", zapcore.InfoLevel) {
+				t.Errorf("after ApplyLogLevels() payments should log errors only and orders fall back to info")
+			}
+		},
+	)
+}
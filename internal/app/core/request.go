@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader is the header a request ID is accepted from and echoed in
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the key of the request ID in the gin context and the name of its log field
+	RequestIDKey = "request_id"
+)
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFrom returns the request ID of ctx, empty outside a request
+func RequestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// NewRequestID generates a random request ID of 32 hex characters
+func NewRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id) // Never fails, see rand.Read
+	return hex.EncodeToString(id)
+}
+
+// RequestIDFields returns the log fields of the request ID of ctx, none outside a request
+func RequestIDFields(ctx context.Context) []zap.Field {
+	requestID := RequestIDFrom(ctx)
+	if requestID == "" {
+		return nil
+	}
+	return []zap.Field{zap.String(RequestIDKey, requestID)}
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+)
+
+// healthcheckTarget is where the healthcheck connects, a TCP address or a Unix socket, over HTTP or HTTPS
+type healthcheckTarget struct {
+	network string // tcp or unix
+	address string
+	tls     bool
+	// insecure skips the certificate verification, the configured server is probed on the loopback
+	// interface where its certificate hostname rarely matches
+	insecure bool
+}
+
+// healthcheck probes /ready or /alive on the server of the resolved config, without needing curl in the
+// image, and exits ExitOK when it answers 200 or ExitFailure otherwise
+func healthcheck(cli *cli, args []string) int {
+	flags := cli.newFlagSet("healthcheck")
+	ready := flags.Bool("ready", false, "probe /ready, whether the server can take traffic (default)")
+	alive := flags.Bool("alive", false, "probe /alive, whether the process is up")
+	timeout := flags.Duration("timeout", 5*time.Second, "give up after this long")
+	addr := flags.String("addr", "", "probe this address instead of the configured one, host:port, https://host:port or unix:///path.sock")
+	insecure := flags.Bool("insecure", false, "skip the TLS certificate verification of --addr, e.g. for self-signed certificates")
+	clientCert := flags.String("client-cert", "", "client certificate to present when the server requires mTLS")
+	clientKey := flags.String("client-key", "", "key of --client-cert")
+
+	config, _, err := cli.loadConfig(flags, args)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+	if *ready && *alive {
+		fmt.Fprintln(cli.stderr, "--ready and --alive are mutually exclusive")
+		return ExitUsage
+	}
+	path := "/ready"
+	if *alive {
+		path = "/alive"
+	}
+
+	target := configHealthcheckTarget(config)
+	if *addr != "" {
+		if target, err = parseHealthcheckTarget(*addr); err != nil {
+			fmt.Fprintf(cli.stderr, "Invalid --addr: %s\n", err.Error())
+			return ExitUsage
+		}
+	}
+
+	target.insecure = target.insecure || *insecure
+	tlsConfig := &tls.Config{InsecureSkipVerify: target.insecure}
+	if *clientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			fmt.Fprintf(cli.stderr, "Invalid --client-cert: %s\n", err.Error())
+			return ExitUsage
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	status, body, err := target.probe(path, *timeout, tlsConfig)
+	if err != nil {
+		fmt.Fprintf(cli.stderr, "Unhealthy: %s\n", err.Error())
+		return ExitFailure
+	}
+	if status != http.StatusOK {
+		fmt.Fprintf(cli.stderr, "Unhealthy: %s returned %d %s\n", path, status, body)
+		return ExitFailure
+	}
+	fmt.Fprintf(cli.stdout, "Healthy: %s returned %d %s\n", path, status, body)
+	return ExitOK
+}
+
+// configHealthcheckTarget returns the listener serving the probes of the server configured by config, the
+// admin server when APP_ADMIN_PORT is set, the Unix socket of APP_LISTEN or else the loopback interface
+func configHealthcheckTarget(config *core.Config) healthcheckTarget {
+	if config.AdminPort != 0 {
+		return healthcheckTarget{network: "tcp", address: loopbackAddr(config.GetAdminAddr())}
+	}
+	if network, address := config.GetListenAddr(); network == "unix" {
+		return healthcheckTarget{network: network, address: address, tls: config.TLS.Enabled(), insecure: true}
+	}
+	return healthcheckTarget{
+		network:  "tcp",
+		address:  loopbackAddr(config.GetAddr()),
+		tls:      config.TLS.Enabled(),
+		insecure: true,
+	}
+}
+
+func parseHealthcheckTarget(addr string) (healthcheckTarget, error) {
+	if !strings.Contains(addr, "://") {
+		return healthcheckTarget{network: "tcp", address: loopbackAddr(addr)}, nil
+	}
+
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return healthcheckTarget{}, err
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return healthcheckTarget{network: "tcp", address: loopbackAddr(parsed.Host), tls: parsed.Scheme == "https"}, nil
+	case "unix":
+		return healthcheckTarget{network: "unix", address: parsed.Path}, nil
+	default:
+		return healthcheckTarget{}, fmt.Errorf("unsupported scheme '%s', expected http, https or unix", parsed.Scheme)
+	}
+}
+
+// loopbackAddr fills in the loopback host of addresses like ":8001"
+func loopbackAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || (host != "" && host != "0.0.0.0" && host != "::") {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// probe GETs path and returns the status code along with the start of the body
+func (target healthcheckTarget) probe(path string, timeout time.Duration, tlsConfig *tls.Config) (int, string, error) {
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, target.network, target.address)
+		},
+		TLSClientConfig: tlsConfig,
+	}
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	defer transport.CloseIdleConnections()
+
+	scheme, host := "http", target.address
+	if target.tls {
+		scheme = "https"
+	}
+	if target.network == "unix" {
+		host = "localhost"
+	}
+	response, err := client.Get(scheme + "://" + host + path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 512))
+	if err != nil {
+		return 0, "", err
+	}
+	return response.StatusCode, strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultHookTimeout is how long a Hook is given to start or stop when it sets no Timeout
+const DefaultHookTimeout = 15 * time.Second
+
+var (
+	hooksLock sync.Mutex
+	hooks     []Hook
+)
+
+// Hook is a component started at boot and stopped at shutdown, like a database pool, a background
+// worker or a cache. Both Start and Stop are optional.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	// Timeout bounds Start and Stop each, DefaultHookTimeout when 0
+	Timeout time.Duration
+}
+
+// RegisterHook adds a hook to the lifecycle of the server started by Run, it must be called before Run.
+// Hooks start in registration order, so dependencies must be registered first, and stop in reverse order.
+func RegisterHook(hook Hook) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+
+	hooks = append(hooks, hook)
+}
+
+// Lifecycle starts hooks in order and stops the started ones in reverse order
+type Lifecycle struct {
+	lock    sync.Mutex
+	hooks   []Hook
+	started int
+	logger  *zap.SugaredLogger
+}
+
+// NewLifecycle creates a lifecycle logging to logger
+func NewLifecycle(logger *zap.SugaredLogger) *Lifecycle {
+	return &Lifecycle{logger: logger}
+}
+
+// Append adds a hook, started after the hooks already appended
+func (l *Lifecycle) Append(hook Hook) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs the Start hooks in order. When one fails the hooks already started are stopped
+// in reverse order and the error is returned.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if err := l.run(ctx, hook, "start", hook.Start); err != nil {
+			if stopErr := l.stop(ctx); stopErr != nil {
+				return errors.Join(err, stopErr)
+			}
+			return err
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop runs the Stop hooks of the started hooks in reverse order. Every hook is stopped even
+// when some fail, the failures are returned joined.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.stop(ctx)
+}
+
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if err := l.run(ctx, hook, "stop", hook.Stop); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run calls fn with the hook timeout, returning once the timeout expires even if fn ignores ctx
+func (l *Lifecycle) run(ctx context.Context, hook Hook, action string, fn func(context.Context) error) error {
+	if fn == nil {
+		return nil
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("%s hook '%s' failed: %w", action, hook.Name, err)
+		l.logger.Errorf("Lifecycle %s", err.Error())
+		return err
+	}
+	l.logger.Infof("Lifecycle %s hook '%s' done in %s", action, hook.Name, time.Since(started).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLifecycle(t *testing.T) {
+	newHook := func(name string, calls *[]string, startErr error) Hook {
+		return Hook{
+			Name: name,
+			Start: func(context.Context) error {
+				*calls = append(*calls, "start "+name)
+				return startErr
+			},
+			Stop: func(context.Context) error {
+				*calls = append(*calls, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	t.Run(
+		"starts in order and stops in reverse order", func(t *testing.T) {
+			var calls []string
+			lifecycle := NewLifecycle(zap.NewNop().Sugar())
+			lifecycle.Append(newHook("db", &calls, nil))
+			lifecycle.Append(newHook("worker", &calls, nil))
+
+			if err := lifecycle.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+			if err := lifecycle.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop() unexpected error: %v", err)
+			}
+
+			want := []string{"start db", "start worker", "stop worker", "stop db"}
+			if !reflect.DeepEqual(calls, want) {
+				t.Errorf("calls = %v, want %v", calls, want)
+			}
+		},
+	)
+
+	t.Run(
+		"failed start stops the started hooks", func(t *testing.T) {
+			var calls []string
+			errBroken := errors.New("broken")
+			lifecycle := NewLifecycle(zap.NewNop().Sugar())
+			lifecycle.Append(newHook("db", &calls, nil))
+			lifecycle.Append(newHook("cache", &calls, errBroken))
+			lifecycle.Append(newHook("worker", &calls, nil))
+
+			err := lifecycle.Start(context.Background())
+			if !errors.Is(err, errBroken) {
+				t.Fatalf("Start() error = %v, want %v", err, errBroken)
+			}
+
+			want := []string{"start db", "start cache", "stop db"}
+			if !reflect.DeepEqual(calls, want) {
+				t.Errorf("calls = %v, want %v", calls, want)
+			}
+		},
+	)
+
+	t.Run(
+		"hook timeout", func(t *testing.T) {
+			lifecycle := NewLifecycle(zap.NewNop().Sugar())
+			lifecycle.Append(
+				Hook{
+					Name:    "stuck",
+					Timeout: 10 * time.Millisecond,
+					Stop: func(context.Context) error {
+						time.Sleep(time.Second) // Ignores the context
+						return nil
+					},
+				},
+			)
+			if err := lifecycle.Start(context.Background()); err != nil {
+				t.Fatalf("Start() unexpected error: %v", err)
+			}
+
+			err := lifecycle.Stop(context.Background())
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Stop() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+		},
+	)
+}
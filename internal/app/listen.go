@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by systemd socket activation, after stdin, stdout and stderr
+	listenFdsStart = 3
+	// Names of the sockets, as in FileDescriptorName= of systemd, the server gets the first one of any other name
+	serverFdName   = "http"
+	adminFdName    = "admin"
+	redirectFdName = "redirect"
+	http3FdName    = "http3"
+)
+
+// inheritedSocket is a socket passed by systemd or by the parent of an upgrade along with its name, a
+// listener or, for http3, a packet conn
+type inheritedSocket struct {
+	name       string
+	listener   net.Listener
+	packetConn net.PacketConn
+}
+
+func (s inheritedSocket) Close() error {
+	if s.packetConn != nil {
+		return s.packetConn.Close()
+	}
+	return s.listener.Close()
+}
+
+// inheritedSockets returns the sockets passed by systemd socket activation when LISTEN_PID is this process,
+// or by the parent process on an upgrade, see App.Upgrade. The variables are unset so child processes don't
+// inherit them.
+func inheritedSockets() ([]inheritedSocket, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	upgradeFrom := os.Getenv(upgradeFromEnvKey)
+	if pid == "" && upgradeFrom == "" {
+		return nil, nil
+	}
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", upgradeFromEnvKey} {
+		_ = os.Unsetenv(key)
+	}
+	if pid != strconv.Itoa(os.Getpid()) && upgradeFrom != strconv.Itoa(os.Getppid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS '%s'", fds)
+	}
+	fdNames := strings.Split(names, ":")
+	sockets := make([]inheritedSocket, 0, count)
+	for i := range count {
+		socket := inheritedSocket{}
+		if i < len(fdNames) {
+			socket.name = fdNames[i]
+		}
+		fd := listenFdsStart + i
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		// Both dup the descriptor
+		if socket.name == http3FdName {
+			socket.packetConn, err = net.FilePacketConn(file)
+		} else {
+			socket.listener, err = net.FileListener(file)
+		}
+		if unixListener, ok := socket.listener.(*net.UnixListener); ok && pid == "" {
+			unixListener.SetUnlinkOnClose(true) // Created by the parent of the upgrade, unlike systemd sockets
+		}
+		_ = file.Close()
+		if err != nil {
+			for _, inherited := range sockets {
+				_ = inherited.Close()
+			}
+			for rest := fd + 1; rest < listenFdsStart+count; rest++ {
+				_ = os.NewFile(uintptr(rest), fmt.Sprintf("LISTEN_FD_%d", rest)).Close()
+			}
+			return nil, fmt.Errorf("error using the socket of file descriptor %d: %w", fd, err)
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, nil
+}
+
+// listenUnix listens on the Unix socket at path with the permissions of config, a socket left over by a
+// stopped process is removed first
+func listenUnix(ctx context.Context, path string, config *core.Config) (net.Listener, error) {
+	mode, err := config.GetSocketMode()
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("error setting the permissions of %s: %w", path, err)
+	}
+	if config.SocketGroup != "" {
+		gid, err := lookupGroupID(config.SocketGroup)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("error setting the group of %s: %w", path, err)
+		}
+	}
+	return listener, nil
+}
+
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	found, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(found.Gid)
+}
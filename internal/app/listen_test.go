@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// inheritedSocketsReport is what inheritedSocketsHelper found, in the order of the file descriptors
+type inheritedSocketsReport struct {
+	Sockets []string `json:"sockets"`
+	Error   string   `json:"error"`
+	// Leaked is the number of file descriptors left open, the inherited ones or their duplicates
+	Leaked int `json:"leaked"`
+}
+
+// inheritedSocketsHelper reports the sockets it inherits as activated by systemd, then answers "pong" to a
+// connection on the first listener
+func inheritedSocketsHelper() int {
+	// Open the file descriptors of the network poller before counting
+	if listener, err := net.Listen("tcp", "127.0.0.1:0"); err == nil {
+		_ = listener.Close()
+	}
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	before := openFds()
+	_ = os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	sockets, err := inheritedSockets()
+	report := inheritedSocketsReport{Leaked: openFds() - len(sockets) - (before - count)}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	for _, socket := range sockets {
+		if socket.packetConn != nil {
+			report.Sockets = append(report.Sockets, socket.name+" "+socket.packetConn.LocalAddr().Network())
+		} else {
+			report.Sockets = append(report.Sockets, socket.name+" "+socket.listener.Addr().Network())
+		}
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(report); err != nil || len(sockets) == 0 || sockets[0].listener == nil {
+		return 0
+	}
+
+	listener := sockets[0].listener
+	_ = listener.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := listener.Accept()
+	if err != nil {
+		return 1
+	}
+	_, _ = conn.Write([]byte("pong"))
+	_ = conn.Close()
+	return 0
+}
+
+func openFds() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func TestInheritedSockets(t *testing.T) {
+	tests := []struct {
+		name  string
+		pid   string
+		fds   string
+		count int
+		err   bool
+	}{
+		{"not activated", "", "", 0, false},
+		{"activated for another process", "1", "2", 0, false},
+		{"upgrade", "", "0", 0, false},
+		{"no socket", strconv.Itoa(os.Getpid()), "0", 0, false},
+		{"invalid count", strconv.Itoa(os.Getpid()), "two", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if tt.pid != "" {
+					t.Setenv("LISTEN_PID", tt.pid)
+				} else if tt.fds != "" {
+					t.Setenv(upgradeFromEnvKey, strconv.Itoa(os.Getppid()))
+				}
+				if tt.fds != "" {
+					t.Setenv("LISTEN_FDS", tt.fds)
+				}
+
+				sockets, err := inheritedSockets()
+				if (err != nil) != tt.err {
+					t.Fatalf("inheritedSockets() error = %v, want error %v", err, tt.err)
+				}
+				if len(sockets) != tt.count {
+					t.Errorf("inheritedSockets() = %d sockets, want %d", len(sockets), tt.count)
+				}
+				for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", upgradeFromEnvKey} {
+					if _, ok := os.LookupEnv(key); ok {
+						t.Errorf("%s is still set, child processes would inherit it", key)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestInheritedSocketsOfProcess(t *testing.T) {
+	if openFds() < 0 {
+		t.Skip("no /proc/self/fd to count the open file descriptors")
+	}
+	tcpFile := func(t *testing.T) (*os.File, string) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer listener.Close() // The helper process serves on its own copy
+		file, err := listener.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatalf("listener file: %v", err)
+		}
+		t.Cleanup(func() { _ = file.Close() })
+		return file, listener.Addr().String()
+	}
+	udpFile := func(t *testing.T) *os.File {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer conn.Close()
+		file, err := conn.(*net.UDPConn).File()
+		if err != nil {
+			t.Fatalf("packet conn file: %v", err)
+		}
+		t.Cleanup(func() { _ = file.Close() })
+		return file
+	}
+	regularFile := func(t *testing.T) *os.File {
+		file, err := os.Open(os.Args[0])
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { _ = file.Close() })
+		return file
+	}
+
+	t.Run(
+		"serves on the inherited listener", func(t *testing.T) {
+			file, addr := tcpFile(t)
+			_, stdout := startHelperProcess(
+				t, "inherited-sockets", []*os.File{file, udpFile(t)}, "LISTEN_FDS=2", "LISTEN_FDNAMES=http:http3",
+			)
+			report := readInheritedSocketsReport(t, stdout)
+
+			want := []string{"http tcp", "http3 udp"}
+			if report.Error != "" || !slices.Equal(report.Sockets, want) {
+				t.Fatalf("inheritedSockets() = %v, error %q, want %v", report.Sockets, report.Error, want)
+			}
+			conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+			if err != nil {
+				t.Fatalf("dial %s: %v", addr, err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if message, _ := io.ReadAll(conn); string(message) != "pong" {
+				t.Errorf("helper process answered %q, want %q", message, "pong")
+			}
+		},
+	)
+
+	t.Run(
+		"failure closes every socket", func(t *testing.T) {
+			first, _ := tcpFile(t)
+			last, _ := tcpFile(t)
+			_, stdout := startHelperProcess(
+				t, "inherited-sockets", []*os.File{first, regularFile(t), last},
+				"LISTEN_FDS=3", "LISTEN_FDNAMES=http:admin:redirect",
+			)
+			report := readInheritedSocketsReport(t, stdout)
+
+			if report.Error == "" {
+				t.Errorf("inheritedSockets() with a regular file = %v, want an error", report.Sockets)
+			}
+			if report.Leaked != 0 {
+				t.Errorf("inheritedSockets() left %d file descriptors open, want none", report.Leaked)
+			}
+		},
+	)
+}
+
+func readInheritedSocketsReport(t *testing.T, stdout io.Reader) inheritedSocketsReport {
+	line, err := bufio.NewReader(stdout).ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("read helper process report: %v", err)
+	}
+	var report inheritedSocketsReport
+	if err := json.Unmarshal(line, &report); err != nil {
+		t.Fatalf("helper process report %q: %v", line, err)
+	}
+	return report
+}
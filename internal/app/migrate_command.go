@@ -0,0 +1,30 @@
+package app
+
+import (
+	"fmt"
+)
+
+// The app has no database yet, so the migrate commands only validate the config and report that
+// there is nothing to migrate, with ExitUnavailable so deploy scripts can tell it apart from a failure
+
+func migrateUp(cli *cli, args []string) int {
+	return migrate(cli, "up", args)
+}
+
+func migrateDown(cli *cli, args []string) int {
+	return migrate(cli, "down", args)
+}
+
+func migrateStatus(cli *cli, args []string) int {
+	return migrate(cli, "status", args)
+}
+
+func migrate(cli *cli, action string, args []string) int {
+	flags := cli.newFlagSet("migrate " + action)
+	if _, _, err := cli.loadConfig(flags, args); err != nil {
+		return cli.exitCode(err)
+	}
+
+	fmt.Fprintf(cli.stderr, "migrate %s: no database is configured, there are no migrations\n", action)
+	return ExitUnavailable
+}
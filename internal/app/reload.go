@@ -0,0 +1,27 @@
+package app
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// reloadableHandler serves the current router, swapped atomically when the config is reloaded
+type reloadableHandler struct {
+	router atomic.Pointer[gin.Engine]
+}
+
+func (h *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.Load().ServeHTTP(w, r)
+}
+
+func reloadConfig(app *App, logger *zap.SugaredLogger) {
+	result, err := app.Reload()
+	if err != nil {
+		logger.Errorf("Config reload failed, keeping the current config, error: %s", err.Error())
+		return
+	}
+	result.Log(logger)
+}
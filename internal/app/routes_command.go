@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/api"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// printRoutes builds the routers of the resolved config and lists their routes, the admin ones too
+// when APP_ADMIN_PORT is set
+func printRoutes(cli *cli, args []string) int {
+	flags := cli.newFlagSet("routes")
+	config, _, err := cli.loadConfig(flags, args)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+
+	gin.SetMode(gin.ReleaseMode) // Skip gin's debug route logging
+	router, err := newRouter(config, zap.NewNop(), func(c *gin.Context) { c.Next() }, api.NewRateLimiter(), nil)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+
+	type server struct {
+		name   string
+		router *gin.Engine
+	}
+	servers := []server{{"public", router}}
+	if config.AdminPort != 0 {
+		adminRouter, err := newAdminRouter(config, zap.NewNop(), func(c *gin.Context) { c.Next() }, nil)
+		if err != nil {
+			return cli.exitCode(err)
+		}
+		servers = append(servers, server{"admin", adminRouter})
+	}
+
+	writer := tabwriter.NewWriter(cli.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SERVER\tMETHOD\tPATH\tHANDLER")
+	for _, server := range servers {
+		for _, route := range server.router.Routes() {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", server.name, route.Method, route.Path, route.Handler)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return cli.exitCode(err)
+	}
+	return ExitOK
+}
@@ -4,130 +4,238 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/Koubae/GoAnyBusiness/internal/app/api"
 	"github.com/Koubae/GoAnyBusiness/internal/app/core"
-	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
-// Run starts the server
+// Run executes the command line of the process and exits with its exit code, see Execute
 func Run() {
-	config := initEnv()
+	os.Exit(Execute(os.Args[1:]))
+}
 
-	loggerBase, loggerMiddleware, err := core.CreateLogger(config)
+// serve starts the App of the resolved config and blocks until it is shut down by a signal,
+// SIGHUP reloads the config instead and SIGUSR2 hands the listeners over to a new process first
+func serve(cli *cli, args []string) int {
+	config, envFiles, err := initEnv(cli, args)
 	if err != nil {
-		log.Fatalf("Error creating logger: %s", err.Error())
+		return cli.exitCode(err)
 	}
 
-	defer func(loggerBase *zap.Logger) {
-		// Sync can return "invalid argument" on non-file sinks like /dev/stderr (benign).
-		if err := loggerBase.Sync(); err != nil {
-			// Ignore known safe errors
-			if err.Error() == "sync /dev/stderr: invalid argument" || err.Error() == "sync /dev/stdout: invalid argument" {
-				return
-			}
-
-			log.Printf("Error syncing logger: %s", err.Error())
-		}
-	}(loggerBase)
-	logger := loggerBase.Sugar()
-
-	router := gin.New()
-	router.Use(
-		*loggerMiddleware,
-		ginzap.RecoveryWithZap(loggerBase, true),
-	)
-	err = api.ConfigureRouter(router, config)
+	app, err := New(config)
 	if err != nil {
-		logger.Fatalf(err.Error())
+		fmt.Fprintln(cli.stderr, err.Error())
+		return ExitFailure
 	}
+	defer app.syncLogger()
 
-	handler := http.MaxBytesHandler(router, 8<<20)
-	srv := &http.Server{
-		Addr:              config.GetAddr(),
-		Handler:           handler,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       15 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
+	logger := app.logger.Sugar()
+	build := core.GetBuildInfo()
+	logger.Infof(
+		"%s %s (commit: %s, built: %s, %s %s)",
+		config.AppName, config.AppVersion, build.Commit, build.BuildDate, build.GoVersion, build.Platform,
+	)
+	if len(envFiles) > 0 {
+		logger.Infof("Loaded env files: %s", strings.Join(envFiles, ", "))
+	} else {
+		logger.Infof("No env files found, using the environment only")
 	}
-	srvName := fmt.Sprintf("Service %s-V%s (%s)", config.AppName, config.AppVersion, config.GetAddr())
-
-	startUpErr := make(chan error, 1)
-	go func() {
-		logger.Infof("%s | Server starting...", srvName)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			startUpErr <- fmt.Errorf("server issues while listening: %v", err)
-			return
-		}
-		startUpErr <- nil
-	}()
-	logger.Infof("%s | Server started", srvName)
+	logger.Debugf("Config resolved: %s", config)
 
+	// Before starting, so signals sent once the server listens, like SIGUSR2 whose default action is to
+	// terminate the process, are handled
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR2)
 	defer signal.Stop(sigCh)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	logger.Infof("%s | Server starting...", app.name)
+	if err := app.Start(context.Background()); err != nil {
+		logger.Errorf("%s - server startup failure, error: %v", app.name, err)
+		return ExitFailure
+	}
+
+	// The first signal starts the graceful shutdown, a second one forces it by cancelling stopCtx
+	shutdown, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	stopCtx, force := context.WithCancel(context.Background())
+	defer force()
+	upgrades := &upgrader{app: app, timeout: config.Server.UpgradeTimeout}
 	go func() {
-		sig := <-sigCh
-		logger.Infof("%s - shutting down gracefully (received signal: %s); press Ctrl+C again to force", srvName, sig)
-		cancel()
+		for sig := range sigCh {
+			switch {
+			case sig == syscall.SIGHUP:
+				logger.Infof("%s - reloading config (received signal: %s)", app.name, sig)
+				reloadConfig(app, logger)
+			case sig == syscall.SIGUSR2:
+				if err := upgrades.start(shutdown, cancel); err != nil {
+					logger.Warnf("%s - ignoring upgrade, %s (received signal: %s)", app.name, err, sig)
+				} else {
+					logger.Infof("%s - upgrading, starting a new process with the listeners (received signal: %s)", app.name, sig)
+				}
+			case shutdown.Err() == nil:
+				logger.Infof("%s - shutting down gracefully (received signal: %s); press Ctrl+C again to force", app.name, sig)
+				cancel()
+			default:
+				logger.Warnf("%s - forcing shutdown (received signal: %s)", app.name, sig)
+				force()
+				return
+			}
+		}
 	}()
 
+	exitCode := ExitOK
+	drain := false
 	select {
-	case <-ctx.Done():
-	case err := <-startUpErr:
+	case <-shutdown.Done():
+		drain = true
+	case err := <-app.Done():
 		if err != nil {
-			logger.Errorf("%s - server startup/runtime failure, error: %v", srvName, err) // startup/runtime failure
-			return
+			logger.Errorf("%s - server runtime failure, error: %v", app.name, err)
+			exitCode = ExitFailure
 		}
-		logger.Infof(
-			"%s - Server Shutting down gracefully (After server stop serving), press Ctrl+C again to force",
-			srvName,
-		)
+	}
+	// An upgrade in progress is given up, killing the new process, before the listeners are closed
+	cancel()
+	upgrades.wait()
+	// After an upgrade the new process serves the same listeners, so /ready must not fail
+	if drain && !upgrades.upgraded.Load() {
+		app.Drain(stopCtx)
 	}
 
-	// The context is used to inform the server it has 10 seconds to finish
-	// the request it is currently handling
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		_ = srv.Close() // If shutdown times out, force close:
-		logger.Infof("%s - Server forced to shutdown: %v", srvName, err)
-		return
+	// Stop gives in-flight requests config.Server.ShutdownTimeout to complete
+	if err := app.Stop(stopCtx); err != nil || stopCtx.Err() != nil {
+		exitCode = ExitFailure
+	}
+	logger.Infof("%s - Server exiting", app.name)
+	return exitCode
+}
+
+// upgrader runs the upgrades of the signal loop aside, one at a time, so signals keep being handled
+// while the new process starts
+type upgrader struct {
+	app     *App
+	timeout time.Duration
+	// upgraded is set once the new process serves
+	upgraded atomic.Bool
+
+	lock    sync.Mutex
+	running bool
+	closed  bool
+	done    sync.WaitGroup
+}
+
+// start hands the listeners over to a new process in the background, see App.Upgrade, then calls
+// onUpgraded once it serves. Cancelling ctx gives the upgrade up, wait then waits for it.
+func (u *upgrader) start(ctx context.Context, onUpgraded func()) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.closed || ctx.Err() != nil {
+		return errors.New("shutting down")
 	}
+	if u.running {
+		return errors.New("an upgrade is in progress")
+	}
+	u.running = true
+	u.done.Add(1)
+	go func() {
+		defer u.done.Done()
+		if upgrade(ctx, u.app, u.timeout) {
+			u.upgraded.Store(true)
+			onUpgraded()
+		}
+		u.lock.Lock()
+		u.running = false
+		u.lock.Unlock()
+	}()
+	return nil
+}
 
-	logger.Infof("%s - Server Shutdown, cleaning up resources", srvName)
-	// TODO: cleanup resources
-	logger.Infof("%s - Server exiting", srvName)
+// wait returns once the upgrade in progress, if any, is done, no other upgrade starts after
+func (u *upgrader) wait() {
+	u.lock.Lock()
+	u.closed = true
+	u.lock.Unlock()
+
+	u.done.Wait()
 }
 
-func initEnv() *core.Config {
-	err := godotenv.Load(".env")
+// upgrade hands the listeners of app over to a new process, see App.Upgrade, and tells whether it serves,
+// cancelling ctx gives it up
+func upgrade(ctx context.Context, app *App, timeout time.Duration) bool {
+	logger := app.logger.Sugar()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	process, err := app.Upgrade(ctx)
 	if err != nil {
-		logger := zap.Must(zap.NewProduction()).Sugar()
-		logger.Fatalf("Error loading .env file: %s", err.Error())
+		logger.Errorf("%s - upgrade failed, keeping on serving, error: %v", app.name, err)
+		return false
 	}
+	logger.Infof("%s - upgraded, the new process %d serves, shutting down gracefully", app.name, process.Pid)
+	return true
+}
 
-	config := core.NewConfig(core.DefaultConfigName)
-	switch config.Env {
-	case core.Testing:
-		gin.SetMode(gin.TestMode)
-	case core.Development, core.Staging:
-		gin.SetMode(gin.DebugMode)
-	default:
-		gin.SetMode(gin.ReleaseMode)
+func newRouter(
+	config *core.Config,
+	loggerBase *zap.Logger,
+	loggerMiddleware gin.HandlerFunc,
+	limiter *api.RateLimiter,
+	reload func() (*core.ReloadResult, error),
+) (*gin.Engine, error) {
+	router := gin.New()
+	router.Use(
+		api.RequestID(),
+		api.ContextLogger(loggerBase),
+		loggerMiddleware,
+		api.Recovery(),
+	)
+	if err := api.ConfigureRouter(router, config, limiter, reload); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// newAdminRouter creates the router of the admin server, without the CORS, maintenance and rate
+// limiting middlewares of the public one
+func newAdminRouter(
+	config *core.Config,
+	loggerBase *zap.Logger,
+	loggerMiddleware gin.HandlerFunc,
+	reload func() (*core.ReloadResult, error),
+) (*gin.Engine, error) {
+	router := gin.New()
+	router.Use(
+		api.RequestID(),
+		api.ContextLogger(loggerBase),
+		loggerMiddleware,
+		api.Recovery(),
+	)
+	if err := api.ConfigureAdminRouter(router, config, reload); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+func initEnv(cli *cli, args []string) (*core.Config, []string, error) {
+	config, envFiles, err := cli.loadConfig(cli.newFlagSet("serve"), args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := core.RegisterConfig(core.DefaultConfigName, config); err != nil {
+		return nil, nil, err
 	}
-	return config
+	return config, envFiles, nil
 }
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+// tlsReloader serves the TLS config built from the certificate, key and client CA files, rebuilt
+// on the next handshake once ReloadInterval elapsed and one of the files changed
+type tlsReloader struct {
+	config core.TLSConfig
+	logger *zap.SugaredLogger
+
+	lock      sync.Mutex
+	current   *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+// newTLSReloader loads the files once, so invalid certificates are reported at startup
+func newTLSReloader(config core.TLSConfig, logger *zap.SugaredLogger) (*tlsReloader, error) {
+	reloader := &tlsReloader{config: config, logger: logger}
+	modTimes, err := reloader.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	if reloader.current, err = reloader.load(); err != nil {
+		return nil, err
+	}
+	reloader.modTimes = modTimes
+	reloader.checkedAt = time.Now()
+	return reloader, nil
+}
+
+// serverConfig returns the tls.Config of the server, every handshake gets the current config
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: core.TLSVersions[r.config.MinVersion],
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.get(), nil
+		},
+	}
+}
+
+func (r *tlsReloader) get() *tls.Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.checkedAt) < r.config.ReloadInterval {
+		return r.current
+	}
+	r.checkedAt = time.Now()
+
+	modTimes, err := r.statFiles()
+	if err != nil {
+		r.logger.Errorf("Error checking TLS files, keeping the current certificate, error: %s", err.Error())
+		return r.current
+	}
+	if timesEqual(modTimes, r.modTimes) {
+		return r.current
+	}
+
+	config, err := r.load()
+	if err != nil {
+		r.logger.Errorf("Error reloading TLS files, keeping the current certificate, error: %s", err.Error())
+		return r.current
+	}
+	r.current, r.modTimes = config, modTimes
+	r.logger.Infof("TLS certificate reloaded from %s", r.config.CertPath)
+	return r.current
+}
+
+func (r *tlsReloader) load() (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(r.config.CertPath, r.config.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   core.TLSVersions[r.config.MinVersion],
+		NextProtos:   []string{"h2", "http/1.1"},
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	if r.config.ClientCAPath != "" {
+		content, err := os.ReadFile(r.config.ClientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TLS client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, errors.New("error loading TLS client CA: no PEM certificate found")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (r *tlsReloader) statFiles() ([]time.Time, error) {
+	paths := []string{r.config.CertPath, r.config.KeyPath}
+	if r.config.ClientCAPath != "" {
+		paths = append(paths, r.config.ClientCAPath)
+	}
+
+	modTimes := make([]time.Time, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func timesEqual(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// httpsRedirect redirects every request to the same URL over HTTPS on httpsPort
+func httpsRedirect(httpsPort uint16) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = strings.Trim(r.Host, "[]")
+			}
+			if httpsPort != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(int(httpsPort)))
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+		},
+	)
+}
+
+// listenerPort returns the TCP port of listener, or fallback when it listens on a Unix socket
+func listenerPort(listener net.Listener, fallback uint16) uint16 {
+	if address, ok := listener.Addr().(*net.TCPAddr); ok {
+		return uint16(address.Port)
+	}
+	return fallback
+}
+
+// altSvcHandler advertises the HTTP/3 server with Alt-Svc headers on the HTTP/1.1 and HTTP/2 responses
+func altSvcHandler(server *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor < 3 {
+				_ = server.SetQUICHeaders(w.Header()) // Fails only while not listening yet
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key to dir
+func writeCertificate(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(certPath, certPEM, 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSReloader(t *testing.T) {
+	commonName := func(t *testing.T, reloader *tlsReloader) string {
+		certificate, err := x509.ParseCertificate(reloader.get().Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		return certificate.Subject.CommonName
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := writeCertificate(t, dir, "first")
+	config := core.TLSConfig{CertPath: certPath, KeyPath: keyPath, MinVersion: "1.2", ReloadInterval: time.Nanosecond}
+	reloader, err := newTLSReloader(config, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("newTLSReloader() unexpected error: %v", err)
+	}
+	if got := commonName(t, reloader); got != "first" {
+		t.Errorf("certificate = %v, want %v", got, "first")
+	}
+
+	writeCertificate(t, dir, "rotated")
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certPath, keyPath} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+	if got := commonName(t, reloader); got != "rotated" {
+		t.Errorf("certificate after rotation = %v, want %v", got, "rotated")
+	}
+
+	if err := os.WriteFile(certPath, []byte("broken"), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+	if err := os.Chtimes(certPath, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if got := commonName(t, reloader); got != "rotated" {
+		t.Errorf("certificate after a broken rotation = %v, want the previous one %v", got, "rotated")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		port     uint16
+		location string
+	}{
+		{"default port", "example.com:8080", 443, "https://example.com/orders?page=2"},
+		{"custom port", "example.com", 8443, "https://example.com:8443/orders?page=2"},
+		{"ipv6", "[::1]:8080", 8443, "https://[::1]:8443/orders?page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				request := httptest.NewRequest(http.MethodGet, "/orders?page=2", nil)
+				request.Host = tt.host
+				recorder := httptest.NewRecorder()
+				httpsRedirect(tt.port).ServeHTTP(recorder, request)
+
+				if recorder.Code != http.StatusPermanentRedirect {
+					t.Errorf("status = %v, want %v", recorder.Code, http.StatusPermanentRedirect)
+				}
+				if got := recorder.Header().Get("Location"); got != tt.location {
+					t.Errorf("Location = %v, want %v", got, tt.location)
+				}
+			},
+		)
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	certPath, keyPath := writeCertificate(t, t.TempDir(), "localhost")
+	app := newTestApp(
+		t, []string{"--app-port=0", "--app-tls-cert-path=" + certPath, "--app-tls-key-path=" + keyPath, "--app-tls-http3=true"},
+	)
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	defer func() {
+		if err := app.Stop(context.Background()); err != nil {
+			t.Errorf("Stop() unexpected error: %v", err)
+		}
+	}()
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	httpsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+	response, err := httpsClient.Get("https://" + app.Addr() + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping over HTTPS unexpected error: %v", err)
+	}
+	_ = response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Errorf("HTTPS protocol = %v, want HTTP/2", response.Proto)
+	}
+	if altSvc := response.Header.Get("Alt-Svc"); !strings.HasPrefix(altSvc, "h3=") {
+		t.Errorf("Alt-Svc = %q, want an h3 entry", altSvc)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer transport.Close()
+	response, err = (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get("https://" + app.Addr() + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping over HTTP/3 unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if response.ProtoMajor != 3 || string(body) != "pong" {
+		t.Errorf("GET /ping over HTTP/3 = %v %q, want HTTP/3 \"pong\"", response.Proto, body)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	certPath, keyPath := writeCertificate(t, t.TempDir(), "localhost")
+	clientCertPath, clientKeyPath := writeCertificate(t, t.TempDir(), "client")
+	untrustedCertPath, untrustedKeyPath := writeCertificate(t, t.TempDir(), "untrusted")
+	app := newTestApp(
+		t, []string{
+			"--app-port=0", "--app-tls-cert-path=" + certPath, "--app-tls-key-path=" + keyPath,
+			"--app-tls-client-ca-path=" + clientCertPath, // Self-signed, so its own CA
+		},
+	)
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	defer func() {
+		if err := app.Stop(context.Background()); err != nil {
+			t.Errorf("Stop() unexpected error: %v", err)
+		}
+	}()
+
+	tests := []struct {
+		name     string
+		certPath string
+		keyPath  string
+		wantErr  bool
+	}{
+		{"no client certificate", "", "", true},
+		{"untrusted client certificate", untrustedCertPath, untrustedKeyPath, true},
+		{"valid client certificate", clientCertPath, clientKeyPath, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				tlsConfig := &tls.Config{InsecureSkipVerify: true}
+				if tt.certPath != "" {
+					certificate, err := tls.LoadX509KeyPair(tt.certPath, tt.keyPath)
+					if err != nil {
+						t.Fatalf("load client certificate: %v", err)
+					}
+					// Sent even when not signed by the CAs the server asks for
+					tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						return &certificate, nil
+					}
+				}
+				client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+
+				response, err := client.Get("https://" + app.Addr() + "/ping")
+				if err == nil {
+					_ = response.Body.Close()
+				}
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("GET /ping error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && response.StatusCode != http.StatusOK {
+					t.Errorf("GET /ping status = %v, want %v", response.StatusCode, http.StatusOK)
+				}
+			},
+		)
+	}
+}
+
+func TestHTTPSRedirectServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	redirectPort := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	certPath, keyPath := writeCertificate(t, t.TempDir(), "localhost")
+	app := newTestApp(
+		t, []string{
+			"--app-port=0", "--app-tls-cert-path=" + certPath, "--app-tls-key-path=" + keyPath,
+			"--app-tls-redirect-port=" + strconv.Itoa(redirectPort),
+		},
+	)
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatalf("Start() unexpected error: %v", err)
+	}
+	defer func() {
+		if err := app.Stop(context.Background()); err != nil {
+			t.Errorf("Stop() unexpected error: %v", err)
+		}
+	}()
+	_, port, err := net.SplitHostPort(app.Addr())
+	if err != nil {
+		t.Fatalf("SplitHostPort(%q) unexpected error: %v", app.Addr(), err)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       5 * time.Second,
+	}
+	response, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/orders?page=2", redirectPort))
+	if err != nil {
+		t.Fatalf("GET /orders unexpected error: %v", err)
+	}
+	_ = response.Body.Close()
+
+	want := "https://127.0.0.1:" + port + "/orders?page=2"
+	if got := response.Header.Get("Location"); response.StatusCode != http.StatusPermanentRedirect || got != want {
+		t.Errorf("GET /orders = %v %v, want %v %v", response.StatusCode, got, http.StatusPermanentRedirect, want)
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+)
+
+const (
+	// upgradeFromEnvKey is the pid of the parent handing its sockets over, in place of LISTEN_PID which
+	// can't be known before the child is started
+	upgradeFromEnvKey = "APP_UPGRADE_FROM"
+	// upgradeReadyFdEnvKey is the file descriptor the child writes to once it serves, see notifyUpgradeReady
+	upgradeReadyFdEnvKey = "APP_UPGRADE_READY_FD"
+)
+
+// Upgrade starts the current executable again with the same arguments and hands it the sockets of every
+// server, as systemd socket activation does, then returns once the new process serves and this app stopped
+// accepting connections, see handOver. Connections keep being accepted by one process or the other, the
+// caller then stops this app with Stop. On failure the new process is killed and this app keeps serving.
+//
+// Both processes read the datagrams of the HTTP/3 UDP socket until this app stops, so its open HTTP/3
+// connections may be reset by the new process, which doesn't know them. Clients then reconnect.
+func (app *App) Upgrade(ctx context.Context) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("error finding the executable: %w", err)
+	}
+
+	files, names, err := app.socketFiles()
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = append(
+		upgradeEnviron(),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		upgradeFromEnvKey+"="+strconv.Itoa(os.Getpid()),
+		upgradeReadyFdEnvKey+"="+strconv.Itoa(listenFdsStart+len(files)),
+	)
+	err = cmd.Start()
+	_ = readyWriter.Close() // Only the child holds it now, so reading gets EOF if it exits
+	if err != nil {
+		app.restoreUnlinkOnClose()
+		return nil, fmt.Errorf("error starting %s: %w", executable, err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		message, err := io.ReadAll(ready)
+		if err == nil && string(message) != "ready" {
+			err = errors.New("the new process exited before serving")
+		}
+		result <- err
+	}()
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("the new process is not serving yet: %w", ctx.Err())
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		go func() { _ = cmd.Wait() }()
+		app.restoreUnlinkOnClose()
+		return nil, err
+	}
+	app.handOver()
+	return cmd.Process, nil
+}
+
+// handOver closes the listeners, leaving new connections to the new process, then waits for the
+// connections already accepted to send their first request, at most APP_SERVER_READ_HEADER_TIMEOUT.
+// http.Server.Shutdown closes the connections whose request comes after it started, unanswered.
+func (app *App) handOver() {
+	app.handedOver.Store(true)
+	app.lock.Lock()
+	for _, listener := range []net.Listener{app.listener, app.adminListener, app.redirectListener} {
+		if listener != nil {
+			_ = listener.Close()
+		}
+	}
+	app.lock.Unlock()
+
+	app.serving.Wait() // Once Serve returns, every connection it accepted is counted
+	deadline := time.Now().Add(app.config.Server.ReadHeaderTimeout)
+	for app.newConnCount.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// trackNewConn counts the connections accepted whose first request is not read yet, see handOver
+func (app *App) trackNewConn(conn net.Conn, state http.ConnState) {
+	if state == http.StateNew {
+		app.newConns.Store(conn, struct{}{})
+		app.newConnCount.Add(1)
+	} else if _, ok := app.newConns.LoadAndDelete(conn); ok {
+		app.newConnCount.Add(-1)
+	}
+}
+
+// socketFiles returns a duplicate of the socket of every server along with its name, see inheritedSockets
+func (app *App) socketFiles() ([]*os.File, []string, error) {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	var files []*os.File
+	var names []string
+	for name, socket := range map[string]any{
+		serverFdName:   app.listener,
+		adminFdName:    app.adminListener,
+		redirectFdName: app.redirectListener,
+		http3FdName:    app.packetConn,
+	} {
+		conn, ok := socket.(syscall.Conn)
+		if !ok {
+			continue // Not started, or not a TCP, UDP or Unix socket
+		}
+		file, err := socketFile(conn, name)
+		if err != nil {
+			return files, nil, fmt.Errorf("error handing over the %s socket: %w", name, err)
+		}
+		files = append(files, file)
+		names = append(names, name)
+	}
+	if len(files) == 0 {
+		return nil, nil, errors.New("no socket to hand over, the app is not started")
+	}
+
+	// The socket file must outlive this process, which stops once the new one serves
+	if unixListener, ok := app.listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+	return files, names, nil
+}
+
+// socketFile duplicates the descriptor of conn. Unlike the File method of net, the Fd call of exec on
+// it keeps the socket non-blocking, which the duplicate shares with conn: a blocking listener would hold
+// its Accept in the kernel past Close, then take a connection it never serves.
+func socketFile(conn syscall.Conn, name string) (*os.File, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var dup int
+	var dupErr error
+	err = raw.Control(
+		func(fd uintptr) {
+			syscall.ForkLock.RLock() // Not inherited by processes started meanwhile
+			defer syscall.ForkLock.RUnlock()
+			if dup, dupErr = syscall.Dup(int(fd)); dupErr == nil {
+				syscall.CloseOnExec(dup)
+			}
+		},
+	)
+	if err == nil {
+		err = dupErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(dup), name), nil
+}
+
+// restoreUnlinkOnClose removes the Unix socket file on Stop again after a failed upgrade
+func (app *App) restoreUnlinkOnClose() {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	if unixListener, ok := app.listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(true)
+	}
+}
+
+// upgradeEnviron returns the environment of the process without the variables of a previous handover, nor
+// the ones set from .env files, which the new process loads again, picking up their changes
+func upgradeEnviron() []string {
+	dotEnvKeys := core.DotEnvKeys()
+	return slices.DeleteFunc(
+		os.Environ(), func(entry string) bool {
+			key, _, _ := strings.Cut(entry, "=")
+			switch key {
+			case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", upgradeFromEnvKey, upgradeReadyFdEnvKey:
+				return true
+			}
+			_, found := slices.BinarySearch(dotEnvKeys, key)
+			return found
+		},
+	)
+}
+
+// notifyUpgradeReady tells the parent of an upgrade that this process serves, so it can stop
+func notifyUpgradeReady() error {
+	value, ok := os.LookupEnv(upgradeReadyFdEnvKey)
+	if !ok {
+		return nil
+	}
+	_ = os.Unsetenv(upgradeReadyFdEnvKey)
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < listenFdsStart {
+		return fmt.Errorf("invalid %s '%s'", upgradeReadyFdEnvKey, value)
+	}
+
+	file := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer file.Close()
+	_, err = file.WriteString("ready")
+	return err
+}
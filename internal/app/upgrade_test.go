@@ -0,0 +1,235 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+)
+
+// serveHelper prints its pid then serves like the serve command, upgrading on SIGUSR2 to another serveHelper
+func serveHelper() int {
+	fmt.Printf("pid %d\n", os.Getpid())
+	return Execute([]string{"serve"})
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run(
+		"not started", func(t *testing.T) {
+			app := newTestApp(t, []string{"--app-port=0"})
+			if _, err := app.Upgrade(context.Background()); err == nil {
+				t.Errorf("Upgrade() of an app not started, want an error")
+			}
+		},
+	)
+
+	t.Run(
+		"notify ready", func(t *testing.T) {
+			reader, writer, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("pipe: %v", err)
+			}
+			defer reader.Close()
+			fd, err := syscall.Dup(int(writer.Fd())) // Closed by notifyUpgradeReady, as by the child of an upgrade
+			_ = writer.Close()
+			if err != nil {
+				t.Fatalf("dup: %v", err)
+			}
+			t.Setenv(upgradeReadyFdEnvKey, strconv.Itoa(fd))
+
+			if err := notifyUpgradeReady(); err != nil {
+				t.Fatalf("notifyUpgradeReady() unexpected error: %v", err)
+			}
+			message, _ := io.ReadAll(reader) // EOF as the writer is closed once notified
+			if string(message) != "ready" {
+				t.Errorf("message = %q, want %q", message, "ready")
+			}
+			if _, ok := os.LookupEnv(upgradeReadyFdEnvKey); ok {
+				t.Errorf("%s is still set, child processes would inherit it", upgradeReadyFdEnvKey)
+			}
+		},
+	)
+
+	t.Run(
+		"hands the listeners over", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.sock")
+			parent, stdout := startHelperProcess(t, "serve", nil, "APP_LISTEN=unix://"+path, "APP_LOG_LEVEL=error")
+			pids := helperPids(stdout)
+			<-pids
+
+			client := unixClient(path)
+			ping := func() error {
+				status, err := get(client, "/ping")
+				if err == nil && status != http.StatusOK {
+					err = fmt.Errorf("status %d", status)
+				}
+				return err
+			}
+			waitForStatus(t, client, "/ping", http.StatusOK)
+
+			var served, failed atomic.Int32
+			var lastErr atomic.Value
+			stop, stopped := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if err := ping(); err != nil {
+						failed.Add(1)
+						lastErr.Store(err.Error())
+					} else {
+						served.Add(1)
+					}
+				}
+			}()
+
+			child := upgradeHelper(t, parent, pids)
+
+			// The new process keeps serving once the old one exited
+			servedByParent := served.Load()
+			for deadline := time.Now().Add(10 * time.Second); served.Load() < servedByParent+10; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the new process doesn't serve")
+				}
+			}
+			close(stop)
+			<-stopped
+			if failed.Load() > 0 {
+				t.Errorf("%d of %d requests failed during the upgrade, last error: %v", failed.Load(), failed.Load()+served.Load(), lastErr.Load())
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("socket file after the old process exited: %v", err)
+			}
+
+			// The new process removes the socket file it inherited once stopped
+			if err := syscall.Kill(child, syscall.SIGTERM); err != nil {
+				t.Fatalf("signal: %v", err)
+			}
+			for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("socket file still exists after the new process stopped")
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"new process reloads the .env files", func(t *testing.T) {
+			dir := t.TempDir()
+			writeDotEnv := func(maintenance bool) {
+				content := fmt.Sprintf("APP_MAINTENANCE_MODE=%t\n", maintenance)
+				if err := os.WriteFile(filepath.Join(dir, core.DotEnvFile), []byte(content), 0o600); err != nil {
+					t.Fatalf("write .env: %v", err)
+				}
+			}
+			writeDotEnv(false)
+			t.Chdir(dir) // Where the helper processes load the .env files from
+
+			path := filepath.Join(dir, "app.sock")
+			parent, stdout := startHelperProcess(t, "serve", nil, "APP_LISTEN=unix://"+path, "APP_LOG_LEVEL=error")
+			pids := helperPids(stdout)
+			<-pids
+			client := unixClient(path)
+			waitForStatus(t, client, "/version", http.StatusOK)
+
+			// The values of the .env files are not passed on as the real environment, which they don't override
+			child := upgradeHelper(t, parent, pids)
+			writeDotEnv(true)
+			if err := syscall.Kill(child, syscall.SIGHUP); err != nil {
+				t.Fatalf("signal: %v", err)
+			}
+			waitForStatus(t, client, "/version", http.StatusServiceUnavailable)
+		},
+	)
+}
+
+// helperPids sends the pids printed by serveHelper on stdout, the ones of the processes it upgrades to included
+func helperPids(stdout io.Reader) <-chan int {
+	pids := make(chan int, 2)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if pid, ok := strings.CutPrefix(scanner.Text(), "pid "); ok {
+				n, _ := strconv.Atoi(pid)
+				pids <- n
+			}
+		}
+	}()
+	return pids
+}
+
+// upgradeHelper upgrades the serveHelper parent, then returns the pid of the new process once the parent exited
+func upgradeHelper(t *testing.T, parent *exec.Cmd, pids <-chan int) int {
+	t.Helper()
+	if err := parent.Process.Signal(syscall.SIGUSR2); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	var child int
+	select {
+	case child = <-pids:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no new process started on SIGUSR2")
+	}
+	t.Cleanup(func() { _ = syscall.Kill(child, syscall.SIGKILL) })
+	if err := parent.Wait(); err != nil {
+		t.Errorf("the upgraded process exited with %v, want 0", err)
+	}
+	return child
+}
+
+// unixClient is a client of the server on the Unix socket at path, with a connection per request, so each
+// one is accepted by either process during an upgrade
+func unixClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func get(client *http.Client, path string) (int, error) {
+	response, err := client.Get("http://unix" + path)
+	if err != nil {
+		return 0, err
+	}
+	_ = response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// waitForStatus waits up to 10 seconds for GET path to answer status
+func waitForStatus(t *testing.T, client *http.Client, path string, status int) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		got, err := get(client, path)
+		if err == nil && got == status {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s = %d, error %v, want %d", path, got, err, status)
+		}
+	}
+}
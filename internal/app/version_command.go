@@ -0,0 +1,41 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/Koubae/GoAnyBusiness/internal/app/core"
+	"github.com/Koubae/GoAnyBusiness/pkg/utils"
+)
+
+// printVersion prints APP_NAME, APP_VERSION and the build metadata, read without validating the rest
+// of the config so it works even when other config values are broken
+func printVersion(cli *cli, args []string) int {
+	flags := cli.newFlagSet("version")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return cli.exitCode(&core.FlagError{Err: err})
+	}
+	if _, err := cli.loadDotEnv(); err != nil {
+		fmt.Fprintf(cli.stderr, "Error loading .env files: %s\n", err.Error())
+		return ExitConfig
+	}
+
+	build := core.GetBuildInfo()
+	name, err := utils.GetEnvStringE("APP_NAME", core.Unknown)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+	version, err := utils.GetEnvStringE("APP_VERSION", build.Version)
+	if err != nil {
+		return cli.exitCode(err)
+	}
+	fmt.Fprintf(
+		cli.stdout, "%s %s (commit: %s, built: %s, %s %s)\n",
+		name, version, build.Commit, build.BuildDate, build.GoVersion, build.Platform,
+	)
+	return ExitOK
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ReadConfigFile reads a YAML, TOML or JSON file, selected by its extension, and
+// flattens it into raw values keyed by dotted path, e.g. {"database": {"port": 5432}}
+// becomes {"database.port": "5432"}. Lists are joined with commas.
+func ReadConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file '%s', error: %w", path, err)
+	}
+
+	document := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &document)
+	case ".toml":
+		err = toml.Unmarshal(content, &document)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&document)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension '%s', expected .yaml, .yml, .toml or .json", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file '%s', error: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfigValues("", document, values); err != nil {
+		return nil, fmt.Errorf("error parsing config file '%s', error: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenConfigValues(prefix string, node any, values map[string]string) error {
+	switch typed := node.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			if err := flattenConfigValues(prefix+key+".", child, values); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		for key, child := range typed {
+			if err := flattenConfigValues(fmt.Sprintf("%s%v.", prefix, key), child, values); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := make([]string, 0, len(typed))
+		for _, item := range typed {
+			switch item.(type) {
+			case map[string]any, map[any]any, []any:
+				return fmt.Errorf("%s: lists may only contain scalar values", strings.TrimSuffix(prefix, "."))
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[strings.TrimSuffix(prefix, ".")] = strings.Join(items, ",")
+	case nil:
+		values[strings.TrimSuffix(prefix, ".")] = ""
+	default:
+		values[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(typed)
+	}
+	return nil
+}
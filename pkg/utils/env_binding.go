@@ -0,0 +1,601 @@
+package utils
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct tags understood by LoadEnv
+const (
+	TagEnv      = "env"
+	TagDefault  = "default"
+	TagRequired = "required"
+	TagPrefix   = "prefix"
+	TagReload   = "reload"
+	TagSecret   = "secret"
+)
+
+// Redacted replaces the value of fields tagged `secret:"true"` wherever it would be shown
+const Redacted = "******"
+
+var (
+	// ErrEnvRequired is reported when a required key is neither set nor has a default
+	ErrEnvRequired = errors.New("required but not set")
+	// ErrUnknownKey is reported when a config file contains a key that is not bound to any field
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// EnvError describes a single key that could not be bound
+type EnvError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *EnvError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %s", e.Key, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: invalid value '%s': %s", e.Key, e.Value, e.Err.Error())
+}
+
+func (e *EnvError) Unwrap() error {
+	return e.Err
+}
+
+// Source identifies the layer a bound value came from
+type Source string
+
+// Supported sources, from lowest to highest precedence
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	// SourceUnset marks a key that no layer set
+	SourceUnset Source = "unset"
+)
+
+// envField is a struct field bound to an environment variable
+type envField struct {
+	key        string
+	path       string
+	defaultVal string
+	hasDefault bool
+	required   bool
+	reloadable bool
+	secret     bool
+	value      reflect.Value
+}
+
+// LoadEnv fills the struct pointed to by v from environment variables.
+//
+// Fields are bound with tags like `env:"APP_PORT" default:"8001" required:"true"`.
+// Nested structs are walked recursively and the optional `prefix:"DB_"` tag on
+// the struct field is prepended to the keys of its fields.
+// Blank values are treated as unset, slices are comma-separated, maps are key=value pairs,
+// time.Duration and ByteSize fields take values like "15s" and "8MiB".
+// Every missing or invalid key is reported, joined in a single error.
+func LoadEnv(v any) error {
+	binder, err := NewBinder(v)
+	if err != nil {
+		return err
+	}
+	binder.ApplyDefaults()
+	binder.ApplyEnv()
+	return binder.Err()
+}
+
+// Binder fills a struct from layered sources. Layers are applied in the order
+// the Apply* methods are called, so later layers override earlier ones.
+type Binder struct {
+	fields  []envField
+	sources map[string]Source
+	errs    []error
+}
+
+// NewBinder creates a Binder for the struct pointed to by v, see LoadEnv for the supported tags
+func NewBinder(v any) (*Binder, error) {
+	fields, err := envFields(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Binder{fields: fields, sources: make(map[string]Source)}, nil
+}
+
+// ApplyDefaults sets every field that has a `default` tag
+func (b *Binder) ApplyDefaults() {
+	for _, field := range b.fields {
+		if field.hasDefault {
+			b.set(field, field.defaultVal, SourceDefault)
+		}
+	}
+}
+
+// OverrideDefaults replaces the default of the given keys, only fields still holding their default
+// or left unset are changed, so it can be applied once the other layers are known
+func (b *Binder) OverrideDefaults(defaults map[string]string) {
+	for _, field := range b.fields {
+		raw, ok := defaults[field.key]
+		if !ok {
+			continue
+		}
+		if source, set := b.sources[field.key]; !set || source == SourceDefault {
+			b.set(field, raw, SourceDefault)
+		}
+	}
+}
+
+// ApplyEnv sets every field whose environment variable is set and not blank,
+// resolving KEY_FILE and file:// references (see LookupEnv)
+func (b *Binder) ApplyEnv() {
+	for _, field := range b.fields {
+		raw, ok, err := LookupEnv(field.key)
+		if err != nil {
+			b.errs = append(b.errs, err)
+			continue
+		}
+		raw = strings.TrimSpace(raw)
+		if ok && raw != "" {
+			b.set(field, raw, SourceEnv)
+		}
+	}
+}
+
+// ApplyValues sets fields from raw values keyed by their file path (e.g. "database.port"), map fields
+// from their string form or from the paths nested under theirs. Unknown paths are reported as errors.
+func (b *Binder) ApplyValues(values map[string]string, source Source) {
+	known := make(map[string]bool, len(b.fields))
+	for _, field := range b.fields {
+		known[field.path] = true
+		raw, ok := values[field.path]
+		if field.value.Kind() == reflect.Map {
+			// A nested map of the file, e.g. {"levels": {"orders": "debug"}}, flattened to "levels.orders"
+			var pairs []string
+			for path, value := range values {
+				if key, nested := strings.CutPrefix(path, field.path+"."); nested {
+					known[path] = true
+					pairs = append(pairs, key+"="+strings.TrimSpace(value))
+				}
+			}
+			if len(pairs) > 0 {
+				slices.Sort(pairs)
+				raw, ok = strings.Join(pairs, ","), true
+			}
+		}
+		if ok {
+			b.set(field, strings.TrimSpace(raw), source)
+		}
+	}
+
+	var unknown []string
+	for path := range values {
+		if !known[path] {
+			unknown = append(unknown, path)
+		}
+	}
+	slices.Sort(unknown)
+	for _, path := range unknown {
+		b.errs = append(b.errs, &EnvError{Key: path, Err: ErrUnknownKey})
+	}
+}
+
+// RegisterFlags registers a flag for every field on fs; the flag name is the
+// lower-cased key with dashes, so APP_PORT becomes --app-port
+func (b *Binder) RegisterFlags(fs *flag.FlagSet) {
+	for _, field := range b.fields {
+		fs.Var(&fieldFlag{isBool: field.value.Kind() == reflect.Bool}, FlagName(field.key), "overrides "+field.key)
+	}
+}
+
+// ApplyFlags sets every field whose flag was passed on the command line; fs must be parsed
+func (b *Binder) ApplyFlags(fs *flag.FlagSet) {
+	byFlag := make(map[string]envField, len(b.fields))
+	for _, field := range b.fields {
+		byFlag[FlagName(field.key)] = field
+	}
+	fs.Visit(
+		func(f *flag.Flag) {
+			if field, ok := byFlag[f.Name]; ok {
+				b.set(field, strings.TrimSpace(f.Value.String()), SourceFlag)
+			}
+		},
+	)
+}
+
+// FlagArgs returns the field flags passed on the command line as --name=value args; fs must be parsed
+func (b *Binder) FlagArgs(fs *flag.FlagSet) []string {
+	byFlag := make(map[string]bool, len(b.fields))
+	for _, field := range b.fields {
+		byFlag[FlagName(field.key)] = true
+	}
+
+	var args []string
+	fs.Visit(
+		func(f *flag.Flag) {
+			if byFlag[f.Name] {
+				args = append(args, "--"+f.Name+"="+f.Value.String())
+			}
+		},
+	)
+	return args
+}
+
+// Sources returns the layer that last set each key
+func (b *Binder) Sources() map[string]Source {
+	return maps.Clone(b.sources)
+}
+
+// Err returns every invalid value seen so far plus every required key left unset
+func (b *Binder) Err() error {
+	errs := slices.Clone(b.errs)
+	for _, field := range b.fields {
+		if _, ok := b.sources[field.key]; !ok && field.required {
+			errs = append(errs, &EnvError{Key: field.key, Err: ErrEnvRequired})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Binder) set(field envField, raw string, source Source) {
+	if raw == "" {
+		return
+	}
+	if err := setFieldValue(field.value, raw); err != nil {
+		if field.secret {
+			raw = Redacted
+		}
+		b.errs = append(b.errs, &EnvError{Key: field.key, Value: raw, Err: err})
+		return
+	}
+	b.sources[field.key] = source
+}
+
+// FlagName returns the command line flag name bound to an env key
+func FlagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+type fieldFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+func (f *fieldFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// FieldChange describes a bound field whose value differs between two structs
+type FieldChange struct {
+	Key        string `json:"key"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// DiffFields compares the bound fields of two pointers to structs of the same type.
+// Fields tagged `reload:"true"` are reported as reloadable.
+func DiffFields(previous, next any) ([]FieldChange, error) {
+	previousFields, nextFields, err := pairedFields(previous, next)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FieldChange
+	for i, field := range previousFields {
+		nextField := nextFields[i]
+		if reflect.DeepEqual(field.value.Interface(), nextField.value.Interface()) {
+			continue
+		}
+		changes = append(
+			changes, FieldChange{
+				Key:        field.key,
+				Old:        formatFieldValue(field),
+				New:        formatFieldValue(nextField),
+				Reloadable: field.reloadable,
+			},
+		)
+	}
+	return changes, nil
+}
+
+// CopyFields copies the bound fields with the given keys from src into dst, both pointers to structs of the same type
+func CopyFields(dst, src any, keys ...string) error {
+	dstFields, srcFields, err := pairedFields(dst, src)
+	if err != nil {
+		return err
+	}
+
+	for i, field := range dstFields {
+		if slices.Contains(keys, field.key) {
+			field.value.Set(srcFields[i].value)
+		}
+	}
+	return nil
+}
+
+func pairedFields(a, b any) ([]envField, []envField, error) {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return nil, nil, fmt.Errorf("expected values of the same type, got %T and %T", a, b)
+	}
+	aFields, err := envFields(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	bFields, err := envFields(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aFields, bFields, nil
+}
+
+// FieldValue is the current value of a bound field
+type FieldValue struct {
+	Key    string
+	Path   string
+	Value  any
+	Secret bool
+}
+
+// DescribeFields returns the current value of every bound field of the struct pointed to by v,
+// with the value of secret fields replaced by Redacted
+func DescribeFields(v any) ([]FieldValue, error) {
+	fields, err := envFields(v)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]FieldValue, 0, len(fields))
+	for _, field := range fields {
+		var value any = Redacted
+		switch {
+		case field.secret:
+		case field.value.Type() == durationType || field.value.Type() == byteSizeType:
+			value = fmt.Sprint(field.value.Interface())
+		default:
+			value = field.value.Interface()
+		}
+		values = append(values, FieldValue{Key: field.key, Path: field.path, Value: value, Secret: field.secret})
+	}
+	return values, nil
+}
+
+// FormatFields renders the bound fields of the struct pointed to by v as KEY=value pairs,
+// with the value of secret fields redacted, so it is safe to log
+func FormatFields(v any) string {
+	fields, err := envFields(v)
+	if err != nil {
+		return err.Error()
+	}
+
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, field.key+"="+formatFieldValue(field))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func formatFieldValue(field envField) string {
+	if field.secret {
+		return Redacted
+	}
+
+	value := field.value
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, fmt.Sprint(value.Index(i).Interface()))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		keys := value.MapKeys()
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", key.Interface(), value.MapIndex(key).Interface()))
+		}
+		slices.Sort(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+func envFields(v any) ([]envField, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a non-nil pointer to a struct, got %T", v)
+	}
+
+	var fields []envField
+	if err := collectEnvFields(rv.Elem(), "", "", &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func collectEnvFields(rv reflect.Value, prefix, pathPrefix string, fields *[]envField) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		structField := rt.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		value := rv.Field(i)
+		path := pathPrefix + fieldPathName(structField)
+
+		key, tagged := structField.Tag.Lookup(TagEnv)
+		if !tagged {
+			if structField.Type.Kind() == reflect.Struct {
+				nestedPrefix := prefix + structField.Tag.Get(TagPrefix)
+				if err := collectEnvFields(value, nestedPrefix, path+".", fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+
+		if !isSupportedKind(structField.Type) {
+			return fmt.Errorf("field %s.%s has unsupported type %s", rt.Name(), structField.Name, structField.Type)
+		}
+
+		defaultVal, hasDefault := structField.Tag.Lookup(TagDefault)
+		required, _ := strconv.ParseBool(structField.Tag.Get(TagRequired))
+		reloadable, _ := strconv.ParseBool(structField.Tag.Get(TagReload))
+		secret, _ := strconv.ParseBool(structField.Tag.Get(TagSecret))
+		*fields = append(
+			*fields, envField{
+				key:        prefix + key,
+				path:       path,
+				defaultVal: defaultVal,
+				hasDefault: hasDefault,
+				required:   required,
+				reloadable: reloadable,
+				secret:     secret,
+				value:      value,
+			},
+		)
+	}
+	return nil
+}
+
+// fieldPathName returns the name used for the field in config files, taken from the `json` tag
+func fieldPathName(structField reflect.StructField) string {
+	name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return structField.Name
+	}
+	return name
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	byteSizeType = reflect.TypeFor[ByteSize]()
+)
+
+func isSupportedKind(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice:
+		return isSupportedScalarKind(t.Elem().Kind())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	default:
+		return isSupportedScalarKind(t.Kind())
+	}
+}
+
+func isSupportedScalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func setFieldValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.Slice:
+		return setSliceValue(value, raw)
+	case reflect.Map:
+		parsed, err := ParseMap(raw)
+		if err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(parsed).Convert(value.Type()))
+		return nil
+	default:
+		return setScalarValue(value, raw)
+	}
+}
+
+func setSliceValue(value reflect.Value, raw string) error {
+	items := strings.Split(raw, ",")
+	slice := reflect.MakeSlice(value.Type(), 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		elem := reflect.New(value.Type().Elem()).Elem()
+		if err := setScalarValue(elem, item); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	value.Set(slice)
+	return nil
+}
+
+func setScalarValue(value reflect.Value, raw string) error {
+	switch value.Type() {
+	case durationType:
+		parsed, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(parsed))
+		return nil
+	case byteSizeType:
+		parsed, err := ParseBytes(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected a bool")
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an int of %d bits", value.Type().Bits())
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an unsigned int of %d bits", value.Type().Bits())
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return errors.New("expected a float")
+		}
+		value.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
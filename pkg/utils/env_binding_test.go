@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
+)
+
+type testDatabaseConfig struct {
+	Host string `env:"HOST" default:"localhost"`
+	Port uint16 `env:"PORT" default:"5432"`
+}
+
+type testEnvConfig struct {
+	Name     string             `env:"TEST_LOAD_NAME" required:"true"`
+	Port     int                `env:"TEST_LOAD_PORT" default:"8001"`
+	Debug    bool               `env:"TEST_LOAD_DEBUG"`
+	Ratio    float64            `env:"TEST_LOAD_RATIO" default:"0.5"`
+	Proxies  []string           `env:"TEST_LOAD_PROXIES"`
+	Ports    []int              `env:"TEST_LOAD_PORTS" default:"1,2"`
+	Database testDatabaseConfig `prefix:"TEST_LOAD_DB_"`
+}
+
+func TestLoadEnv(t *testing.T) {
+	cleanup := func(keys ...string) {
+		for _, key := range keys {
+			err := os.Unsetenv(key)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		want        testEnvConfig
+		wantErrKeys []string
+	}{
+		{
+			name: "defaults applied",
+			env:  map[string]string{"TEST_LOAD_NAME": "app"},
+			want: testEnvConfig{
+				Name:     "app",
+				Port:     8001,
+				Ratio:    0.5,
+				Ports:    []int{1, 2},
+				Database: testDatabaseConfig{Host: "localhost", Port: 5432},
+			},
+		},
+		{
+			name: "values from env",
+			env: map[string]string{
+				"TEST_LOAD_NAME":    "app",
+				"TEST_LOAD_PORT":    "9000",
+				"TEST_LOAD_DEBUG":   "true",
+				"TEST_LOAD_RATIO":   "1.5",
+				"TEST_LOAD_PROXIES": "a, b,,c",
+				"TEST_LOAD_PORTS":   "3,4",
+				"TEST_LOAD_DB_HOST": "db",
+				"TEST_LOAD_DB_PORT": "6543",
+			},
+			want: testEnvConfig{
+				Name:     "app",
+				Port:     9000,
+				Debug:    true,
+				Ratio:    1.5,
+				Proxies:  []string{"a", "b", "c"},
+				Ports:    []int{3, 4},
+				Database: testDatabaseConfig{Host: "db", Port: 6543},
+			},
+		},
+		{
+			name: "blank values fall back to default",
+			env:  map[string]string{"TEST_LOAD_NAME": "app", "TEST_LOAD_PORT": "   "},
+			want: testEnvConfig{
+				Name:     "app",
+				Port:     8001,
+				Ratio:    0.5,
+				Ports:    []int{1, 2},
+				Database: testDatabaseConfig{Host: "localhost", Port: 5432},
+			},
+		},
+		{
+			name: "every missing or invalid key is reported",
+			env: map[string]string{
+				"TEST_LOAD_PORT":    "not_a_number",
+				"TEST_LOAD_DEBUG":   "not_a_bool",
+				"TEST_LOAD_PORTS":   "1,bad",
+				"TEST_LOAD_DB_PORT": "70000",
+			},
+			wantErrKeys: []string{
+				"TEST_LOAD_NAME", "TEST_LOAD_PORT", "TEST_LOAD_DEBUG", "TEST_LOAD_PORTS", "TEST_LOAD_DB_PORT",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				for key, value := range tt.env {
+					err := os.Setenv(key, value)
+					if err != nil {
+						return
+					}
+				}
+				defer func() {
+					for key := range tt.env {
+						cleanup(key)
+					}
+				}()
+
+				var got testEnvConfig
+				err := LoadEnv(&got)
+
+				if len(tt.wantErrKeys) > 0 {
+					if err == nil {
+						t.Fatalf("LoadEnv() expected an error, got nil")
+					}
+					for _, key := range tt.wantErrKeys {
+						if !strings.Contains(err.Error(), key) {
+							t.Errorf("LoadEnv() error %q does not mention %s", err.Error(), key)
+						}
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("LoadEnv() unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("LoadEnv() = %+v, want %+v", got, tt.want)
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"required error is typed", func(t *testing.T) {
+			var got testEnvConfig
+			err := LoadEnv(&got)
+
+			var envErr *EnvError
+			if !errors.As(err, &envErr) || envErr.Key != "TEST_LOAD_NAME" {
+				t.Fatalf("LoadEnv() error = %v, want *EnvError for TEST_LOAD_NAME", err)
+			}
+			if !errors.Is(err, ErrEnvRequired) {
+				t.Errorf("LoadEnv() error = %v, want ErrEnvRequired", err)
+			}
+		},
+	)
+
+	t.Run(
+		"typed fields", func(t *testing.T) {
+			type typedConfig struct {
+				Timeout time.Duration     `env:"TEST_LOAD_TIMEOUT" default:"15s"`
+				Limit   ByteSize          `env:"TEST_LOAD_LIMIT" default:"8MiB"`
+				Headers map[string]string `env:"TEST_LOAD_HEADERS" default:"a=1,b=2"`
+			}
+
+			var got typedConfig
+			if err := LoadEnv(&got); err != nil {
+				t.Fatalf("LoadEnv() unexpected error: %v", err)
+			}
+			want := typedConfig{
+				Timeout: 15 * time.Second,
+				Limit:   8 * MiB,
+				Headers: map[string]string{"a": "1", "b": "2"},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadEnv() = %+v, want %+v", got, want)
+			}
+		},
+	)
+
+	t.Run(
+		"non struct pointer rejected", func(t *testing.T) {
+			var got testEnvConfig
+			if err := LoadEnv(got); err == nil {
+				t.Errorf("LoadEnv() expected an error for non pointer value")
+			}
+		},
+	)
+}
+
+func TestBinder(t *testing.T) {
+	t.Run(
+		"layers override in order", func(t *testing.T) {
+			err := os.Setenv("TEST_LOAD_PORT", "9000")
+			if err != nil {
+				return
+			}
+			defer os.Unsetenv("TEST_LOAD_PORT")
+
+			var got testEnvConfig
+			binder, err := NewBinder(&got)
+			if err != nil {
+				t.Fatalf("NewBinder() unexpected error: %v", err)
+			}
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			binder.RegisterFlags(flags)
+			if err := flags.Parse([]string{"--test-load-debug", "--test-load-db-host=flag-db"}); err != nil {
+				t.Fatalf("flags.Parse() unexpected error: %v", err)
+			}
+
+			binder.ApplyDefaults()
+			binder.ApplyValues(
+				map[string]string{"Name": "file-app", "Port": "7000", "Database.Host": "file-db"},
+				SourceFile,
+			)
+			binder.ApplyEnv()
+			binder.ApplyFlags(flags)
+			if err := binder.Err(); err != nil {
+				t.Fatalf("Binder.Err() unexpected error: %v", err)
+			}
+
+			want := testEnvConfig{
+				Name:     "file-app",
+				Port:     9000,
+				Debug:    true,
+				Ratio:    0.5,
+				Ports:    []int{1, 2},
+				Database: testDatabaseConfig{Host: "flag-db", Port: 5432},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Binder = %+v, want %+v", got, want)
+			}
+
+			wantSources := map[string]Source{
+				"TEST_LOAD_NAME":    SourceFile,
+				"TEST_LOAD_PORT":    SourceEnv,
+				"TEST_LOAD_DEBUG":   SourceFlag,
+				"TEST_LOAD_RATIO":   SourceDefault,
+				"TEST_LOAD_PORTS":   SourceDefault,
+				"TEST_LOAD_DB_HOST": SourceFlag,
+				"TEST_LOAD_DB_PORT": SourceDefault,
+			}
+			if sources := binder.Sources(); !reflect.DeepEqual(sources, wantSources) {
+				t.Errorf("Binder.Sources() = %v, want %v", sources, wantSources)
+			}
+		},
+	)
+
+	t.Run(
+		"unknown file keys are reported", func(t *testing.T) {
+			var got testEnvConfig
+			binder, err := NewBinder(&got)
+			if err != nil {
+				t.Fatalf("NewBinder() unexpected error: %v", err)
+			}
+			binder.ApplyValues(map[string]string{"Name": "app", "Nmae": "typo"}, SourceFile)
+			if err := binder.Err(); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Binder.Err() = %v, want ErrUnknownKey", err)
+			}
+		},
+	)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	want := map[string]string{
+		"name":          "app",
+		"port":          "9000",
+		"proxies":       "a,b",
+		"database.host": "db",
+	}
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		wantErr  bool
+	}{
+		{
+			name:     "yaml",
+			fileName: "config.yaml",
+			content:  "name: app\nport: 9000\nproxies: [a, b]\ndatabase:\n  host: db\n",
+		},
+		{
+			name:     "toml",
+			fileName: "config.toml",
+			content:  "name = \"app\"\nport = 9000\nproxies = [\"a\", \"b\"]\n[database]\nhost = \"db\"\n",
+		},
+		{
+			name:     "json",
+			fileName: "config.json",
+			content:  `{"name": "app", "port": 9000, "proxies": ["a", "b"], "database": {"host": "db"}}`,
+		},
+		{
+			name:     "unsupported extension",
+			fileName: "config.ini",
+			content:  "name=app",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), tt.fileName)
+				if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+					t.Fatalf("WriteFile() unexpected error: %v", err)
+				}
+
+				got, err := ReadConfigFile(path)
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("ReadConfigFile() expected an error, got nil")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ReadConfigFile() unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("ReadConfigFile() = %v, want %v", got, want)
+				}
+			},
+		)
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	type reloadConfig struct {
+		Port    int      `env:"TEST_DIFF_PORT"`
+		Level   string   `env:"TEST_DIFF_LEVEL" reload:"true"`
+		Proxies []string `env:"TEST_DIFF_PROXIES" reload:"true"`
+	}
+
+	previous := &reloadConfig{Port: 8001, Level: "INFO", Proxies: []string{"a"}}
+	next := &reloadConfig{Port: 8002, Level: "DEBUG", Proxies: []string{"a"}}
+
+	changes, err := DiffFields(previous, next)
+	if err != nil {
+		t.Fatalf("DiffFields() unexpected error: %v", err)
+	}
+	want := []FieldChange{
+		{Key: "TEST_DIFF_PORT", Old: "8001", New: "8002", Reloadable: false},
+		{Key: "TEST_DIFF_LEVEL", Old: "INFO", New: "DEBUG", Reloadable: true},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffFields() = %+v, want %+v", changes, want)
+	}
+
+	if err := CopyFields(previous, next, "TEST_DIFF_LEVEL"); err != nil {
+		t.Fatalf("CopyFields() unexpected error: %v", err)
+	}
+	if previous.Level != "DEBUG" || previous.Port != 8001 {
+		t.Errorf("CopyFields() = %+v, want only Level copied", previous)
+	}
+
+	type secretConfig struct {
+		Token string `env:"TEST_DIFF_TOKEN" secret:"true"`
+	}
+	changes, err = DiffFields(&secretConfig{Token: "old"}, &secretConfig{Token: "new"})
+	if err != nil {
+		t.Fatalf("DiffFields() unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Old != Redacted || changes[0].New != Redacted {
+		t.Errorf("DiffFields() = %+v, want the secret redacted", changes)
+	}
+	if got := FormatFields(&secretConfig{Token: "value"}); got != "TEST_DIFF_TOKEN="+Redacted {
+		t.Errorf("FormatFields() = %v, want the secret redacted", got)
+	}
+
+	if _, err := DiffFields(previous, &testEnvConfig{}); err == nil {
+		t.Errorf("DiffFields() expected an error for different types")
+	}
+}
@@ -1,47 +1,135 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Secret indirection, so values like passwords can be mounted as files (Docker/Kubernetes secrets)
+const (
+	// FileKeySuffix reads KEY from the file named by KEY_FILE, e.g. DB_PASSWORD_FILE=/run/secrets/db_password
+	FileKeySuffix = "_FILE"
+	// FileRefPrefix reads KEY from the referenced file, e.g. DB_PASSWORD=file:///run/secrets/db_password
+	FileRefPrefix = "file://"
+)
+
+// LookupEnv is like os.LookupEnv but resolves KEY_FILE and file:// references to the
+// content of the file, without trailing newlines. Setting both KEY and KEY_FILE is an error,
+// unless KEY is blank, while a blank KEY_FILE is ignored.
+func LookupEnv(key string) (string, bool, error) {
+	val, ok := os.LookupEnv(key)
+	path, fileOk := os.LookupEnv(key + FileKeySuffix)
+	fileOk = fileOk && strings.TrimSpace(path) != ""
+	if ok && fileOk && strings.TrimSpace(val) != "" {
+		return "", false, &EnvError{Key: key, Err: fmt.Errorf("both %s and %s%s are set", key, key, FileKeySuffix)}
+	}
+
+	if fileOk {
+		return readEnvFile(key, path)
+	}
+	if ok && strings.HasPrefix(val, FileRefPrefix) {
+		return readEnvFile(key, strings.TrimPrefix(val, FileRefPrefix))
+	}
+	return val, ok, nil
+}
+
+func readEnvFile(key, path string) (string, bool, error) {
+	content, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return "", false, &EnvError{Key: key, Err: fmt.Errorf("error reading file: %w", err)}
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// GetEnvString never panics, it returns defaultVal when a KEY_FILE or file:// reference can't be read,
+// see GetEnvStringE for the error
 func GetEnvString(key, defaultVal string) string {
-	if val, ok := os.LookupEnv(key); ok {
+	val, _ := GetEnvStringE(key, defaultVal)
+	return val
+}
+
+// GetEnvStringE is like GetEnvString but returns an *EnvError when the value can't be read
+func GetEnvStringE(key, defaultVal string) (string, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	if ok {
 		val = strings.TrimSpace(val)
 		if val != "" {
-			return val
+			return val, nil
 		}
 	}
-	return defaultVal
+	return defaultVal, nil
 }
 
 func GetEnvInt(key string, defaultVal int) int {
-	if val, ok := os.LookupEnv(key); ok {
-		if valInt, err := strconv.Atoi(val); err != nil {
-			panic(fmt.Sprintf("Invalid value int for %s: %s", key, val))
-		} else {
-			return valInt
+	val, err := GetEnvIntE(key, defaultVal)
+	if err != nil {
+		panic(err.Error())
+	}
+	return val
+}
+
+// GetEnvIntE is like GetEnvInt but returns an *EnvError instead of panicking
+func GetEnvIntE(key string, defaultVal int) (int, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	if ok {
+		valInt, err := strconv.Atoi(val)
+		if err != nil {
+			return defaultVal, &EnvError{Key: key, Value: val, Err: errors.New("expected an int")}
 		}
+		return valInt, nil
 	}
-	return defaultVal
+	return defaultVal, nil
 }
 
 func GetEnvBool(key string, defaultVal bool) bool {
-	if val, ok := os.LookupEnv(key); ok {
-		if valBool, err := strconv.ParseBool(val); err != nil {
-			panic(fmt.Sprintf("Invalid value bool for %s: %s", key, val))
-		} else {
-			return valBool
-		}
+	val, err := GetEnvBoolE(key, defaultVal)
+	if err != nil {
+		panic(err.Error())
 	}
+	return val
+}
 
-	return defaultVal
+// GetEnvBoolE is like GetEnvBool but returns an *EnvError instead of panicking
+func GetEnvBoolE(key string, defaultVal bool) (bool, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	if ok {
+		valBool, err := strconv.ParseBool(val)
+		if err != nil {
+			return defaultVal, &EnvError{Key: key, Value: val, Err: errors.New("expected a bool")}
+		}
+		return valBool, nil
+	}
+	return defaultVal, nil
 }
 
+// GetEnvStringSlice never panics, it returns defaultVal when a KEY_FILE or file:// reference can't be
+// read, see GetEnvStringSliceE for the error
 func GetEnvStringSlice(key string, defaultVal []string) []string {
-	if val, ok := os.LookupEnv(key); ok {
+	val, _ := GetEnvStringSliceE(key, defaultVal)
+	return val
+}
+
+// GetEnvStringSliceE is like GetEnvStringSlice but returns an *EnvError when the value can't be read
+func GetEnvStringSliceE(key string, defaultVal []string) ([]string, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	if ok {
 		items := strings.Split(val, ",")
 		itemsTrimmed := make([]string, 0, len(items))
 		for _, item := range items {
@@ -50,28 +138,130 @@ func GetEnvStringSlice(key string, defaultVal []string) []string {
 			}
 		}
 		if len(itemsTrimmed) > 0 {
-			return itemsTrimmed
+			return itemsTrimmed, nil
 		}
 	}
-	return defaultVal
+	return defaultVal, nil
 }
 
 func GetEnvIntSlice(key string, defaultVal []int) []int {
-	if val, ok := os.LookupEnv(key); ok && strings.TrimSpace(val) != "" {
+	val, err := GetEnvIntSliceE(key, defaultVal)
+	if err != nil {
+		panic(err.Error())
+	}
+	return val
+}
+
+// GetEnvIntSliceE is like GetEnvIntSlice but returns an *EnvError instead of panicking
+func GetEnvIntSliceE(key string, defaultVal []int) ([]int, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	if ok && strings.TrimSpace(val) != "" {
 		items := strings.Split(val, ",")
 		itemsInt := make([]int, 0, len(items))
 		for _, item := range items {
-			if val, err := strconv.Atoi(strings.TrimSpace(item)); err != nil {
-				panic(err.Error())
-			} else {
-				itemsInt = append(itemsInt, val)
+			valInt, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return defaultVal, &EnvError{Key: key, Value: val, Err: fmt.Errorf("item '%s' is not an int", item)}
 			}
+			itemsInt = append(itemsInt, valInt)
 		}
 
 		if len(itemsInt) > 0 {
-			return itemsInt
+			return itemsInt, nil
 		}
 	}
 
-	return defaultVal
+	return defaultVal, nil
+}
+
+func GetEnvFloat(key string, defaultVal float64) float64 {
+	return mustEnv(GetEnvFloatE(key, defaultVal))
+}
+
+// GetEnvFloatE is like GetEnvFloat but returns an *EnvError instead of panicking
+func GetEnvFloatE(key string, defaultVal float64) (float64, error) {
+	return getEnvParsed(key, defaultVal, parseFloat)
+}
+
+// GetEnvDuration reads a duration like "15s" or "1h30m", see time.ParseDuration
+func GetEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	return mustEnv(GetEnvDurationE(key, defaultVal))
+}
+
+// GetEnvDurationE is like GetEnvDuration but returns an *EnvError instead of panicking
+func GetEnvDurationE(key string, defaultVal time.Duration) (time.Duration, error) {
+	return getEnvParsed(key, defaultVal, parseDuration)
+}
+
+// GetEnvBytes reads a byte size like "512", "8MiB" or "10MB", see ParseBytes
+func GetEnvBytes(key string, defaultVal ByteSize) ByteSize {
+	return mustEnv(GetEnvBytesE(key, defaultVal))
+}
+
+// GetEnvBytesE is like GetEnvBytes but returns an *EnvError instead of panicking
+func GetEnvBytesE(key string, defaultVal ByteSize) (ByteSize, error) {
+	return getEnvParsed(key, defaultVal, ParseBytes)
+}
+
+// GetEnvURL reads an absolute URL, with both scheme and host
+func GetEnvURL(key string, defaultVal *url.URL) *url.URL {
+	return mustEnv(GetEnvURLE(key, defaultVal))
+}
+
+// GetEnvURLE is like GetEnvURL but returns an *EnvError instead of panicking
+func GetEnvURLE(key string, defaultVal *url.URL) (*url.URL, error) {
+	return getEnvParsed(key, defaultVal, parseURL)
+}
+
+// GetEnvEnum reads a string that must be one of allowed, compared case-insensitively
+// and returned as spelled in allowed
+func GetEnvEnum(key, defaultVal string, allowed ...string) string {
+	return mustEnv(GetEnvEnumE(key, defaultVal, allowed...))
+}
+
+// GetEnvEnumE is like GetEnvEnum but returns an *EnvError instead of panicking
+func GetEnvEnumE(key, defaultVal string, allowed ...string) (string, error) {
+	return getEnvParsed(
+		key, defaultVal, func(val string) (string, error) {
+			return parseEnum(val, allowed)
+		},
+	)
+}
+
+// GetEnvMap reads comma-separated key=value pairs like "a=1,b=2"
+func GetEnvMap(key string, defaultVal map[string]string) map[string]string {
+	return mustEnv(GetEnvMapE(key, defaultVal))
+}
+
+// GetEnvMapE is like GetEnvMap but returns an *EnvError instead of panicking
+func GetEnvMapE(key string, defaultVal map[string]string) (map[string]string, error) {
+	return getEnvParsed(key, defaultVal, ParseMap)
+}
+
+// getEnvParsed returns defaultVal when key is unset or blank, otherwise the value parsed by parse
+func getEnvParsed[T any](key string, defaultVal T, parse func(string) (T, error)) (T, error) {
+	val, ok, err := LookupEnv(key)
+	if err != nil {
+		return defaultVal, err
+	}
+	val = strings.TrimSpace(val)
+	if !ok || val == "" {
+		return defaultVal, nil
+	}
+
+	parsed, err := parse(val)
+	if err != nil {
+		return defaultVal, &EnvError{Key: key, Value: val, Err: err}
+	}
+	return parsed, nil
+}
+
+func mustEnv[T any](val T, err error) T {
+	if err != nil {
+		panic(err.Error())
+	}
+	return val
 }
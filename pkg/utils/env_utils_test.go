@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"errors"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	_ "github.com/Koubae/GoAnyBusiness/pkg/testings"
 )
@@ -350,4 +354,593 @@ func TestGetEnv(t *testing.T) {
 			}
 		},
 	)
+
+	t.Run(
+		"error returning variants", func(t *testing.T) {
+			tests := []struct {
+				name     string
+				envValue string
+				call     func(key string) error
+			}{
+				{
+					name:     "int",
+					envValue: "not_a_number",
+					call: func(key string) error {
+						_, err := GetEnvIntE(key, 0)
+						return err
+					},
+				},
+				{
+					name:     "bool",
+					envValue: "not_a_bool",
+					call: func(key string) error {
+						_, err := GetEnvBoolE(key, false)
+						return err
+					},
+				},
+				{
+					name:     "int slice",
+					envValue: "1,bad,3",
+					call: func(key string) error {
+						_, err := GetEnvIntSliceE(key, nil)
+						return err
+					},
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						err := os.Setenv("TEST_ERROR_VARIANT", tt.envValue)
+						if err != nil {
+							return
+						}
+						defer cleanup("TEST_ERROR_VARIANT")
+
+						var envErr *EnvError
+						if err := tt.call("TEST_ERROR_VARIANT"); !errors.As(err, &envErr) {
+							t.Errorf("expected *EnvError, got %v", err)
+						} else if envErr.Key != "TEST_ERROR_VARIANT" {
+							t.Errorf("EnvError.Key = %v, want %v", envErr.Key, "TEST_ERROR_VARIANT")
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"file indirection tests", func(t *testing.T) {
+			secretPath := filepath.Join(t.TempDir(), "secret")
+			if err := os.WriteFile(secretPath, []byte("s3cr3t\n"), 0o600); err != nil {
+				t.Fatalf("WriteFile() unexpected error: %v", err)
+			}
+
+			tests := []struct {
+				name    string
+				env     map[string]string
+				want    string
+				wantErr bool
+			}{
+				{
+					name: "KEY_FILE reads the file",
+					env:  map[string]string{"TEST_SECRET_FILE": secretPath},
+					want: "s3cr3t",
+				},
+				{
+					name: "file:// reference reads the file",
+					env:  map[string]string{"TEST_SECRET": "file://" + secretPath},
+					want: "s3cr3t",
+				},
+				{
+					name:    "missing file is an error",
+					env:     map[string]string{"TEST_SECRET_FILE": secretPath + ".missing"},
+					wantErr: true,
+				},
+				{
+					name:    "KEY and KEY_FILE both set is an error",
+					env:     map[string]string{"TEST_SECRET": "raw", "TEST_SECRET_FILE": secretPath},
+					wantErr: true,
+				},
+				{
+					name: "blank KEY_FILE is unset",
+					env:  map[string]string{"TEST_SECRET": "raw", "TEST_SECRET_FILE": " "},
+					want: "raw",
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						for key, value := range tt.env {
+							err := os.Setenv(key, value)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup("TEST_SECRET", "TEST_SECRET_FILE")
+
+						// GetEnvString never panics, it falls back to the default on errors
+						want := tt.want
+						if tt.wantErr {
+							want = "default"
+						}
+						if got := GetEnvString("TEST_SECRET", "default"); got != want {
+							t.Errorf("GetEnvString() = %v, want %v", got, want)
+						}
+
+						got, err := GetEnvStringE("TEST_SECRET", "default")
+						if tt.wantErr {
+							if err == nil {
+								t.Errorf("GetEnvStringE() expected an error, got %v", got)
+							}
+							return
+						}
+						if err != nil {
+							t.Fatalf("GetEnvStringE() unexpected error: %v", err)
+						}
+						if got != tt.want {
+							t.Errorf("GetEnvStringE() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"float tests", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal float64
+				want       float64
+				panics     bool
+			}{
+				{
+					name:       "valid float",
+					envKey:     "TEST_FLOAT",
+					envValue:   "1.5",
+					defaultVal: 0,
+					want:       1.5,
+				},
+				{
+					name:       "integer is a valid float",
+					envKey:     "TEST_FLOAT",
+					envValue:   "3",
+					defaultVal: 0,
+					want:       3,
+				},
+				{
+					name:       "invalid float panics",
+					envKey:     "TEST_FLOAT",
+					envValue:   "not_a_float",
+					defaultVal: 0.5,
+					want:       0.5,
+					panics:     true,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_FLOAT",
+					envValue:   "",
+					defaultVal: 0.5,
+					want:       0.5,
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvFloat() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvFloat(tt.envKey, tt.defaultVal)
+
+						if tt.panics {
+							t.Errorf("GetEnvFloat() should have panicked but didn't")
+						}
+						if got != tt.want {
+							t.Errorf("GetEnvFloat() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"duration tests", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal time.Duration
+				want       time.Duration
+				panics     bool
+			}{
+				{
+					name:       "seconds",
+					envKey:     "TEST_DURATION",
+					envValue:   "15s",
+					defaultVal: time.Second,
+					want:       15 * time.Second,
+				},
+				{
+					name:       "compound duration",
+					envKey:     "TEST_DURATION",
+					envValue:   "1h30m",
+					defaultVal: time.Second,
+					want:       90 * time.Minute,
+				},
+				{
+					name:       "number without unit panics",
+					envKey:     "TEST_DURATION",
+					envValue:   "15",
+					defaultVal: time.Second,
+					want:       time.Second,
+					panics:     true,
+				},
+				{
+					name:       "blank env returns default",
+					envKey:     "TEST_DURATION",
+					envValue:   "  ",
+					defaultVal: time.Second,
+					want:       time.Second,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_DURATION",
+					envValue:   "",
+					defaultVal: time.Second,
+					want:       time.Second,
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvDuration() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvDuration(tt.envKey, tt.defaultVal)
+
+						if tt.panics {
+							t.Errorf("GetEnvDuration() should have panicked but didn't")
+						}
+						if got != tt.want {
+							t.Errorf("GetEnvDuration() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"bytes tests", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal ByteSize
+				want       ByteSize
+				panics     bool
+			}{
+				{
+					name:       "plain bytes",
+					envKey:     "TEST_BYTES",
+					envValue:   "512",
+					defaultVal: 0,
+					want:       512,
+				},
+				{
+					name:       "binary unit",
+					envKey:     "TEST_BYTES",
+					envValue:   "8MiB",
+					defaultVal: 0,
+					want:       8 << 20,
+				},
+				{
+					name:       "decimal unit",
+					envKey:     "TEST_BYTES",
+					envValue:   "10MB",
+					defaultVal: 0,
+					want:       10_000_000,
+				},
+				{
+					name:       "fractional lower case unit",
+					envKey:     "TEST_BYTES",
+					envValue:   "1.5 kib",
+					defaultVal: 0,
+					want:       1536,
+				},
+				{
+					name:       "largest size",
+					envKey:     "TEST_BYTES",
+					envValue:   "8388607TiB",
+					defaultVal: 0,
+					want:       8388607 * TiB,
+				},
+				{
+					name:       "2^63 overflow panics",
+					envKey:     "TEST_BYTES",
+					envValue:   "8388608TiB",
+					defaultVal: 0,
+					panics:     true,
+				},
+				{
+					name:       "unknown unit panics",
+					envKey:     "TEST_BYTES",
+					envValue:   "8XB",
+					defaultVal: KiB,
+					want:       KiB,
+					panics:     true,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_BYTES",
+					envValue:   "",
+					defaultVal: KiB,
+					want:       KiB,
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvBytes() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvBytes(tt.envKey, tt.defaultVal)
+
+						if tt.panics {
+							t.Errorf("GetEnvBytes() should have panicked but didn't")
+						}
+						if got != tt.want {
+							t.Errorf("GetEnvBytes() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"url tests", func(t *testing.T) {
+			defaultURL, _ := url.Parse("http://localhost")
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal *url.URL
+				want       string
+				panics     bool
+			}{
+				{
+					name:       "absolute url",
+					envKey:     "TEST_URL",
+					envValue:   "https://example.com:8443/api?x=1",
+					defaultVal: defaultURL,
+					want:       "https://example.com:8443/api?x=1",
+				},
+				{
+					name:       "relative url panics",
+					envKey:     "TEST_URL",
+					envValue:   "/api",
+					defaultVal: defaultURL,
+					want:       "http://localhost",
+					panics:     true,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_URL",
+					envValue:   "",
+					defaultVal: defaultURL,
+					want:       "http://localhost",
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvURL() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvURL(tt.envKey, tt.defaultVal)
+
+						if tt.panics {
+							t.Errorf("GetEnvURL() should have panicked but didn't")
+						}
+						if got.String() != tt.want {
+							t.Errorf("GetEnvURL() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"enum tests", func(t *testing.T) {
+			allowed := []string{"json", "console"}
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal string
+				want       string
+				panics     bool
+			}{
+				{
+					name:       "allowed value",
+					envKey:     "TEST_ENUM",
+					envValue:   "console",
+					defaultVal: "json",
+					want:       "console",
+				},
+				{
+					name:       "allowed value is case-insensitive",
+					envKey:     "TEST_ENUM",
+					envValue:   "CONSOLE",
+					defaultVal: "json",
+					want:       "console",
+				},
+				{
+					name:       "value not allowed panics",
+					envKey:     "TEST_ENUM",
+					envValue:   "xml",
+					defaultVal: "json",
+					want:       "json",
+					panics:     true,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_ENUM",
+					envValue:   "",
+					defaultVal: "json",
+					want:       "json",
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvEnum() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvEnum(tt.envKey, tt.defaultVal, allowed...)
+
+						if tt.panics {
+							t.Errorf("GetEnvEnum() should have panicked but didn't")
+						}
+						if got != tt.want {
+							t.Errorf("GetEnvEnum() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
+
+	t.Run(
+		"map tests", func(t *testing.T) {
+			tests := []struct {
+				name       string
+				envKey     string
+				envValue   string
+				defaultVal map[string]string
+				want       map[string]string
+				panics     bool
+			}{
+				{
+					name:       "key value pairs",
+					envKey:     "TEST_MAP",
+					envValue:   "a=1, b = 2,,c=",
+					defaultVal: nil,
+					want:       map[string]string{"a": "1", "b": "2", "c": ""},
+				},
+				{
+					name:       "values may contain equal signs",
+					envKey:     "TEST_MAP",
+					envValue:   "query=a=b",
+					defaultVal: nil,
+					want:       map[string]string{"query": "a=b"},
+				},
+				{
+					name:       "item without equal sign panics",
+					envKey:     "TEST_MAP",
+					envValue:   "a=1,b",
+					defaultVal: map[string]string{"default": "1"},
+					want:       map[string]string{"default": "1"},
+					panics:     true,
+				},
+				{
+					name:       "missing env returns default",
+					envKey:     "MISSING_MAP",
+					envValue:   "",
+					defaultVal: map[string]string{"default": "1"},
+					want:       map[string]string{"default": "1"},
+				},
+			}
+
+			for _, tt := range tests {
+				t.Run(
+					tt.name, func(t *testing.T) {
+						defer func() {
+							if r := recover(); r != nil && !tt.panics {
+								t.Errorf("GetEnvMap() panicked: %v", r)
+							}
+						}()
+						if tt.envValue != "" {
+							err := os.Setenv(tt.envKey, tt.envValue)
+							if err != nil {
+								return
+							}
+						}
+						defer cleanup(tt.envKey)
+
+						got := GetEnvMap(tt.envKey, tt.defaultVal)
+
+						if tt.panics {
+							t.Errorf("GetEnvMap() should have panicked but didn't")
+						}
+						if !reflect.DeepEqual(got, tt.want) {
+							t.Errorf("GetEnvMap() = %v, want %v", got, tt.want)
+						}
+					},
+				)
+			}
+		},
+	)
 }
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a number of bytes, parsed from values like "8MiB" by ParseBytes
+type ByteSize int64
+
+// Byte size units, decimal (KB = 1000) and binary (KiB = 1024)
+const (
+	Byte ByteSize = 1
+	KB            = 1000 * Byte
+	MB            = 1000 * KB
+	GB            = 1000 * MB
+	TB            = 1000 * GB
+	KiB           = 1024 * Byte
+	MiB           = 1024 * KiB
+	GiB           = 1024 * MiB
+	TiB           = 1024 * GiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiB,
+	"kb":  KB,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  MB,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  GB,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  TB,
+	"tib": TiB,
+}
+
+// ParseBytes parses a byte size like "512", "8MiB", "10MB" or "1.5GiB", units are case-insensitive.
+// Single letter units (K, M, G, T) are binary.
+func ParseBytes(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(
+		s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		},
+	)
+	if i == -1 {
+		i = len(s)
+	}
+
+	number, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown byte size unit '%s'", unit)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errors.New("expected a byte size like 512, 8MiB or 10MB")
+	}
+
+	size := value * float64(multiplier)
+	if math.IsNaN(size) || size < 0 {
+		return 0, errors.New("expected a positive byte size")
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which itself overflows
+	if size >= math.MaxInt64 {
+		return 0, errors.New("byte size overflows int64")
+	}
+	return ByteSize(size), nil
+}
+
+// String formats the size with the largest binary unit that divides it exactly
+func (b ByteSize) String() string {
+	for _, unit := range []struct {
+		name string
+		size ByteSize
+	}{{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB}} {
+		if b != 0 && b%unit.size == 0 {
+			return fmt.Sprintf("%d%s", b/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+// ParseMap parses comma-separated key=value pairs like "a=1,b=2", keys and values are trimmed
+func ParseMap(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("item '%s' is not a key=value pair", item)
+		}
+		result[key] = strings.TrimSpace(value)
+	}
+	return result, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.New("expected a float")
+	}
+	return value, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("expected a duration like 15s, 500ms or 1h30m")
+	}
+	return value, nil
+}
+
+func parseURL(s string) (*url.URL, error) {
+	value, err := url.Parse(s)
+	if err != nil || value.Scheme == "" || value.Host == "" {
+		return nil, errors.New("expected an absolute URL like https://example.com")
+	}
+	return value, nil
+}
+
+func parseEnum(s string, allowed []string) (string, error) {
+	for _, option := range allowed {
+		if strings.EqualFold(s, option) {
+			return option, nil
+		}
+	}
+	return "", fmt.Errorf("expected one of %v", allowed)
+}